@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leonkasovan/sffcli/packages/physfs"
+)
+
+/*
+extractArchive mounts an archive and extracts every sff inside it. The archive is mounted at a
+directory named after it, so kfm.zip containing chars/kfm.sff is extracted as kfm/chars/kfm.sff.
+
+packages/physfs is compiled with the ZIP and DIR archivers only (see build.go), so zip and pk3
+archives are supported but 7z, grp, wad etc. are not. Zip entries encrypted with the traditional
+PKWARE method are opened with the password given by -password.
+*/
+func extractArchive(archive string, cmdSavePalette bool) error {
+	abs, err := filepath.Abs(archive)
+	if err != nil {
+		return err
+	}
+	mountPoint := strings.TrimSuffix(filepath.Base(archive), filepath.Ext(archive))
+	if !physfs.Mount(abs, mountPoint, 1) {
+		return fmt.Errorf("Error mounting archive %v: %v", archive, physfs.GetError())
+	}
+	defer physfs.Unmount(abs)
+
+	files, err := findFiles(mountPoint, ".sff")
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("No sff file in archive %v", archive)
+	}
+	for _, file := range files {
+		sff, err := extractSff(file, cmdSavePalette)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			printSummary(sff)
+		}
+	}
+	return nil
+}
+
+// extractCharacter mounts a character archive like extractArchive and extracts the sff referenced by
+// each character def inside it, with sprites named by the actions of the def's air file. Defs without
+// [Files] sprite, such as storyboards, are ignored.
+func extractCharacter(archive string, cmdSavePalette bool) error {
+	abs, err := filepath.Abs(archive)
+	if err != nil {
+		return err
+	}
+	mountPoint := strings.TrimSuffix(filepath.Base(archive), filepath.Ext(archive))
+	if !physfs.Mount(abs, mountPoint, 1) {
+		return fmt.Errorf("Error mounting archive %v: %v", archive, physfs.GetError())
+	}
+	defer physfs.Unmount(abs)
+
+	files, err := findFiles(mountPoint, ".def")
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, file := range files {
+		if interrupted.Load() {
+			break
+		}
+		def, err := loadCharDef(file)
+		if err != nil {
+			continue
+		}
+		found = true
+		extractCharDef(def, cmdSavePalette)
+	}
+	if !found {
+		return fmt.Errorf("No character def with a sprite file in archive %v", archive)
+	}
+	return nil
+}
+
+// findFiles returns the files with extension ext below dir in the physfs search path, sorted by name
+func findFiles(dir, ext string) ([]string, error) {
+	entries, err := physfs.EnumerateFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := path.Join(dir, entry)
+		if isDir, _ := physfs.IsDirectory(name); isDir {
+			sub, err := findFiles(name, ext)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sub...)
+		} else if strings.HasSuffix(strings.ToLower(name), ext) {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// parseColor parses -bg R,G,B, each component 0..255
+func parseColor(v string) (color.NRGBA, error) {
+	parts := strings.Split(v, ",")
+	var rgb [3]uint8
+	if len(parts) != 3 {
+		return color.NRGBA{}, fmt.Errorf("Error: color must be R,G,B, got %v", v)
+	}
+	for i, p := range parts {
+		c, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || c < 0 || c > 255 {
+			return color.NRGBA{}, fmt.Errorf("Error: color must be R,G,B with components 0..255, got %v", v)
+		}
+		rgb[i] = uint8(c)
+	}
+	return color.NRGBA{rgb[0], rgb[1], rgb[2], 255}, nil
+}
+
+// blendColor returns c drawn over the opaque color bg
+func blendColor(c, bg color.NRGBA) color.RGBA {
+	a := uint32(c.A)
+	blend := func(x, y uint8) uint8 {
+		return uint8((uint32(x)*a + uint32(y)*(255-a) + 127) / 255)
+	}
+	return color.RGBA{blend(c.R, bg.R), blend(c.G, bg.G), blend(c.B, bg.B), 255}
+}
+
+// flatten returns img drawn over the -bg color, fully opaque. An indexed image stays indexed,
+// only its palette is blended, so the transparent index gets the background color.
+func flatten(img image.Image, bg color.NRGBA) image.Image {
+	b := img.Bounds()
+	if p, ok := img.(*image.Paletted); ok {
+		pal := make(color.Palette, len(p.Palette))
+		for i, c := range p.Palette {
+			pal[i] = blendColor(straightColor(c), bg)
+		}
+		return &image.Paletted{Pix: p.Pix, Stride: p.Stride, Rect: p.Rect, Palette: pal}
+	}
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.SetRGBA(x, y, blendColor(color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA), bg))
+		}
+	}
+	return out
+}
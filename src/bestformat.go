@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// bestFormats counts the sprites each format encodes in the fewest bytes and the bytes
+// every format would take for all of them, when -best-format is used
+var bestFormats = make(map[string]*compressionStat)
+
+// writeBestFormat encodes the pixels of an indexed sprite as RLE8, RLE5 and LZ5 and prints
+// the size of each and the smallest one. True-color sprites can only be stored as PNG and are left out.
+func writeBestFormat(sff *Sff, s *Sprite, img image.Image) {
+	p, ok := img.(*image.Paletted)
+	if !ok {
+		return
+	}
+	b := p.Bounds()
+	px := make([]byte, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		px = append(px, p.Pix[p.PixOffset(b.Min.X, y):p.PixOffset(b.Max.X, y)]...)
+	}
+	sizes := map[string]int{"RLE8": len(rle8Encode(px)), "RLE5": len(rle5Encode(px))}
+	lz5 := "LZ5 -"
+	if data, ok := lz5Encode(px); ok {
+		sizes["LZ5"] = len(data)
+		lz5 = fmt.Sprintf("LZ5 %v", len(data))
+	}
+	best := "RLE8"
+	for _, name := range []string{"RLE5", "LZ5"} {
+		if n, ok := sizes[name]; ok && n < sizes[best] {
+			best = name
+		}
+	}
+	stored := "PCX"
+	if sff.header.Ver0 != 1 {
+		stored = formatName(-s.rle)
+	}
+	fmt.Printf("%v,%v: RLE8 %v, RLE5 %v, %v bytes, best %v (stored as %v)\n", groupNo(s.Group), groupNo(s.Number), sizes["RLE8"], sizes["RLE5"], lz5, best, stored)
+	for name, n := range sizes {
+		st := bestFormats[name]
+		if st == nil {
+			st = &compressionStat{}
+			bestFormats[name] = st
+		}
+		if name == best {
+			st.count++
+		}
+		st.compressed += int64(n)
+		st.decompressed += int64(len(px))
+	}
+}
+
+// printBestFormats prints, for each format, the number of sprites it suits best and the bytes it takes.
+// LZ5 only counts the sprites using colors 0 to 31.
+func printBestFormats() {
+	names := make([]string, 0, len(bestFormats))
+	for name := range bestFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st := bestFormats[name]
+		fmt.Printf("%v: best for %v sprites, %v bytes (avg %.1fx)\n", name, st.count, st.compressed, ratio(st))
+	}
+}
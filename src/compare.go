@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"slices"
+)
+
+// pixelCRC returns the crc32 of the pixels of img, the palette indices when indexed is set
+// and the colors otherwise. Unlike imageCRC the palette is left out, palettes are compared on their own.
+func pixelCRC(img image.Image, indexed bool) uint32 {
+	crc := crc32.NewIEEE()
+	b := img.Bounds()
+	if p, ok := img.(*image.Paletted); ok && indexed {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			crc.Write(p.Pix[p.PixOffset(b.Min.X, y):p.PixOffset(b.Max.X, y)])
+		}
+		return crc.Sum32()
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			crc.Write([]byte{c.R, c.G, c.B, c.A})
+		}
+	}
+	return crc.Sum32()
+}
+
+// pixelsEqual reports whether pixel x,y of a and b, both from the top-left corner, is the same.
+// A pixel outside one of the images differs.
+func pixelsEqual(a, b image.Image, x, y int, indexed bool) bool {
+	pa, pb := image.Pt(x, y).Add(a.Bounds().Min), image.Pt(x, y).Add(b.Bounds().Min)
+	if !pa.In(a.Bounds()) || !pb.In(b.Bounds()) {
+		return false
+	}
+	if indexed {
+		return a.(*image.Paletted).ColorIndexAt(pa.X, pa.Y) == b.(*image.Paletted).ColorIndexAt(pb.X, pb.Y)
+	}
+	return color.NRGBAModel.Convert(a.At(pa.X, pa.Y)) == color.NRGBAModel.Convert(b.At(pb.X, pb.Y))
+}
+
+// diffImage draws the pixels of b faded, with the pixels that differ from a in opaque red.
+// It returns the image and the number of differing pixels.
+func diffImage(a, b image.Image, indexed bool) (*image.NRGBA, int) {
+	w := max(a.Bounds().Dx(), b.Bounds().Dx())
+	h := max(a.Bounds().Dy(), b.Bounds().Dy())
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	n := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !pixelsEqual(a, b, x, y, indexed) {
+				out.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+				n++
+				continue
+			}
+			c := color.NRGBAModel.Convert(b.At(b.Bounds().Min.X+x, b.Bounds().Min.Y+y)).(color.NRGBA)
+			c.A /= 4
+			out.SetNRGBA(x, y, c)
+		}
+	}
+	return out, n
+}
+
+// compareSprite reports how sprite sb of the second sff differs from sa of the first one.
+// It returns false when the pixels are the same, a differing offset alone is only printed.
+func compareSprite(sa, sb *Sprite) (bool, error) {
+	name := fmt.Sprintf("%v,%v", groupNo(sa.Group), groupNo(sa.Number))
+	if sa.Offset != sb.Offset {
+		fmt.Printf("  offset  %v: %v,%v -> %v,%v\n", name, sa.Offset[0], sa.Offset[1], sb.Offset[0], sb.Offset[1])
+	}
+	ia, err := sa.Decode()
+	if err != nil {
+		return false, err
+	}
+	ib, err := sb.Decode()
+	if err != nil {
+		return false, err
+	}
+	_, pa := ia.(*image.Paletted)
+	_, pb := ib.(*image.Paletted)
+	indexed := pa && pb
+	if ia.Bounds().Size() == ib.Bounds().Size() && pixelCRC(ia, indexed) == pixelCRC(ib, indexed) {
+		return false, nil
+	}
+	diff, n := diffImage(ia, ib, indexed)
+	if ia.Bounds().Size() != ib.Bounds().Size() {
+		fmt.Printf("  changed %v: size %vx%v -> %vx%v\n", name, ia.Bounds().Dx(), ia.Bounds().Dy(), ib.Bounds().Dx(), ib.Bounds().Dy())
+	} else {
+		fmt.Printf("  changed %v: %v of %v pixels\n", name, n, ia.Bounds().Dx()*ia.Bounds().Dy())
+	}
+	if optDiffDir == "" {
+		return true, nil
+	}
+	filename := filepath.Join(namedOutput(optDiffDir), fmt.Sprintf("%v %v diff.png", groupNo(sa.Group), groupNo(sa.Number)))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, diff); err != nil {
+		return true, err
+	}
+	if skipWrite(filename, buf.Len()) {
+		return true, nil
+	}
+	fo, err := createOutputDir(filename)
+	if err != nil {
+		return true, fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	_, err = fo.Write(buf.Bytes())
+	return true, err
+}
+
+// comparePalettes reports the SFF v2 palettes added, removed or with different colors in b,
+// matched by group,number. It returns the number of differing palettes.
+func comparePalettes(a, b *Sff) int {
+	colors := func(sff *Sff, gn [2]int16) []uint32 {
+		idx, ok := sff.palList.PalTable[gn]
+		if !ok || idx < 0 {
+			return nil
+		}
+		pal := sff.palList.Get(idx)
+		if n := sff.palList.numcols[gn]; n > 0 && n < len(pal) {
+			pal = pal[:n]
+		}
+		return pal
+	}
+	n := 0
+	for _, gn := range a.palList.headers {
+		if !slices.Contains(b.palList.headers, gn) {
+			fmt.Printf("  removed palette %v,%v\n", groupNo(gn[0]), groupNo(gn[1]))
+			n++
+		} else if pa, pb := colors(a, gn), colors(b, gn); len(pa) != len(pb) {
+			fmt.Printf("  changed palette %v,%v: %v -> %v colors\n", groupNo(gn[0]), groupNo(gn[1]), len(pa), len(pb))
+			n++
+		} else if !slices.Equal(pa, pb) {
+			diff := 0
+			for i := range pa {
+				if pa[i] != pb[i] {
+					diff++
+				}
+			}
+			fmt.Printf("  changed palette %v,%v: %v of %v colors\n", groupNo(gn[0]), groupNo(gn[1]), diff, len(pa))
+			n++
+		}
+	}
+	for _, gn := range b.palList.headers {
+		if !slices.Contains(a.palList.headers, gn) {
+			fmt.Printf("  added   palette %v,%v\n", groupNo(gn[0]), groupNo(gn[1]))
+			n++
+		}
+	}
+	return n
+}
+
+// compareSff matches the sprites of two sff files by group,number and reports the sprites added,
+// removed and with different pixels, then the palettes that differ. With -diff-dir an image marking
+// the differing pixels is written for every changed sprite.
+func compareSff(nameA, nameB string) error {
+	a, err := OpenSff(nameA)
+	if err != nil {
+		return err
+	}
+	b, err := OpenSff(nameB)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Compare %v with %v\n", nameA, nameB)
+	var added, removed, changed, same int
+	for _, sa := range a.spriteList {
+		if a.GetSprite(sa.Group, sa.Number) != sa {
+			continue // duplicated group,number, only the first one is compared
+		}
+		sb := b.GetSprite(sa.Group, sa.Number)
+		if sb == nil {
+			fmt.Printf("  removed %v,%v\n", groupNo(sa.Group), groupNo(sa.Number))
+			removed++
+			continue
+		}
+		diff, err := compareSprite(sa, sb)
+		if err != nil {
+			fmt.Println(err)
+		}
+		if diff {
+			changed++
+		} else if err == nil {
+			same++
+		}
+	}
+	for _, sb := range b.spriteList {
+		if b.GetSprite(sb.Group, sb.Number) == sb && a.GetSprite(sb.Group, sb.Number) == nil {
+			fmt.Printf("  added   %v,%v\n", groupNo(sb.Group), groupNo(sb.Number))
+			added++
+		}
+	}
+	pals := comparePalettes(a, b)
+	fmt.Printf("%v sprites added, %v removed, %v changed, %v the same, %v palettes differ\n", added, removed, changed, same, pals)
+	return nil
+}
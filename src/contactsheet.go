@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+const (
+	sheetPadding = 4 // space around each cell
+	sheetChecker = 8 // size of a checkerboard square
+	glyphScale   = 2 // size of a font pixel
+)
+
+// 3x5 bitmap font, one byte per row, bit 2 is the leftmost pixel
+var glyphs = map[rune][5]byte{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	',': {0, 0, 0, 2, 4},
+	'-': {0, 0, 7, 0, 0},
+}
+
+type sheetEntry struct {
+	label string
+	img   image.Image
+}
+
+// sheetEntries collects every saved sprite when -contact-sheet is used
+var sheetEntries []sheetEntry
+
+func addToContactSheet(s *Sprite, img image.Image) {
+	sheetEntries = append(sheetEntries, sheetEntry{fmt.Sprintf("%v,%v", groupNo(s.Group), groupNo(s.Number)), img})
+}
+
+func labelWidth(label string) int {
+	return len(label) * 4 * glyphScale
+}
+
+func drawLabel(dst *image.RGBA, x, y int, label string) {
+	for _, r := range label {
+		g := glyphs[r]
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				if g[row]&(4>>col) == 0 {
+					continue
+				}
+				rect := image.Rect(x+col*glyphScale, y+row*glyphScale, x+(col+1)*glyphScale, y+(row+1)*glyphScale)
+				draw.Draw(dst, rect, image.Black, image.Point{}, draw.Src)
+			}
+		}
+		x += 4 * glyphScale
+	}
+}
+
+func drawChecker(dst *image.RGBA, r image.Rectangle) {
+	light := image.NewUniform(color.RGBA{0xcc, 0xcc, 0xcc, 0xff})
+	dark := image.NewUniform(color.RGBA{0x99, 0x99, 0x99, 0xff})
+	for y := r.Min.Y; y < r.Max.Y; y += sheetChecker {
+		for x := r.Min.X; x < r.Max.X; x += sheetChecker {
+			src := light
+			if ((x-r.Min.X)/sheetChecker+(y-r.Min.Y)/sheetChecker)%2 != 0 {
+				src = dark
+			}
+			draw.Draw(dst, image.Rect(x, y, x+sheetChecker, y+sheetChecker).Intersect(r), src, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// writeContactSheet lays out all collected sprites in a grid of cols columns,
+// each drawn on a checkerboard with its group,number printed underneath, and writes it like the sprite images.
+func writeContactSheet(filename string, cols int) error {
+	if len(sheetEntries) == 0 {
+		return fmt.Errorf("No sprite for contact sheet %v", filename)
+	}
+	cellW, cellH := 0, 0
+	for _, e := range sheetEntries {
+		b := e.img.Bounds()
+		cellW = max(cellW, b.Dx(), labelWidth(e.label))
+		cellH = max(cellH, b.Dy())
+	}
+	labelH := 6 * glyphScale
+	cellW += 2 * sheetPadding
+	cellH += 2*sheetPadding + labelH
+	rows := (len(sheetEntries) + cols - 1) / cols
+	if len(sheetEntries) < cols {
+		cols = len(sheetEntries)
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*cellW, rows*cellH))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, e := range sheetEntries {
+		x, y := (i%cols)*cellW+sheetPadding, (i/cols)*cellH+sheetPadding
+		b := e.img.Bounds()
+		r := image.Rect(x, y, x+b.Dx(), y+b.Dy())
+		drawChecker(sheet, r)
+		draw.Draw(sheet, r, e.img, b.Min, draw.Over)
+		drawLabel(sheet, x, y+cellH-2*sheetPadding-labelH+glyphScale, e.label)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, sheet); err != nil {
+		return err
+	}
+	if skipWrite(filename, buf.Len()) {
+		return nil
+	}
+	fo, err := createOutputDir(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	if _, err := fo.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	fmt.Printf("Contact sheet %v created with %v sprites\n", filename, len(sheetEntries))
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// parseCrop parses -crop x,y,w,h, a rectangle in sprite pixels with its top-left corner at x,y
+func parseCrop(v string) (image.Rectangle, error) {
+	parts := strings.Split(v, ",")
+	var n [4]int
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("Error: -crop requires x,y,w,h, got %v", v)
+	}
+	for i, p := range parts {
+		c, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || c < 0 {
+			return image.Rectangle{}, fmt.Errorf("Error: -crop requires x,y,w,h with numbers >= 0, got %v", v)
+		}
+		n[i] = c
+	}
+	if n[2] == 0 || n[3] == 0 {
+		return image.Rectangle{}, fmt.Errorf("Error: -crop requires a width and height above 0, got %v", v)
+	}
+	return image.Rect(n[0], n[1], n[0]+n[2], n[1]+n[3]), nil
+}
+
+// crop cuts the -crop rectangle out of img and moves the sprite axis accordingly.
+// The rectangle is clipped to the sprite, a sprite outside of it becomes a transparent 1x1 image.
+func (s *Sprite) crop(img image.Image) image.Image {
+	b := img.Bounds()
+	r := optCrop.Add(b.Min).Intersect(b)
+	if r.Empty() {
+		s.Size = [2]uint16{1, 1}
+		if p, ok := img.(*image.Paletted); ok {
+			out := image.NewPaletted(image.Rect(0, 0, 1, 1), p.Palette)
+			out.Pix[0] = uint8(optTransparentIndex)
+			return out
+		}
+		return image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	}
+	s.Offset[0] -= int16(r.Min.X - b.Min.X)
+	s.Offset[1] -= int16(r.Min.Y - b.Min.Y)
+	s.Size = [2]uint16{uint16(r.Dx()), uint16(r.Dy())}
+	return img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(r)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvWriter receives one row per sprite of every sff, in file order, when -csv is used
+var csvWriter io.Writer
+
+const csvHeader = "index,group,number,width,height,xoffset,yoffset,coldepth,format,palidx,filename"
+
+// spriteFormatAndFile returns the format name and image filename of sprite s for -csv and -ndjson,
+// size is its data size in the sff and empty tells a zero-size sprite without valid link.
+// filename is empty for sprites without their own image.
+func spriteFormatAndFile(sff *Sff, s *Sprite, size uint32, empty bool) (string, string) {
+	format, filename := "PCX", sff.spriteFilename(s)
+	if sff.header.Ver0 != 1 {
+		format = formatName(-s.rle)
+	}
+	if empty {
+		format = "empty"
+	} else if size == 0 {
+		format = "linked"
+	}
+	if empty || size == 0 && !optWriteLinked || !inRange(s.index) || !spriteSelected(s) {
+		filename = ""
+	}
+	return format, filename
+}
+
+// writeSpriteCsv writes the row of sprite s, see spriteFormatAndFile for size and empty
+func writeSpriteCsv(sff *Sff, s *Sprite, size uint32, empty bool) {
+	format, filename := spriteFormatAndFile(sff, s, size, empty)
+	fmt.Fprintf(csvWriter, "%v,%v,%v,%v,%v,%v,%v,%v,%v,%v,%v\n", s.index, groupNo(s.Group), groupNo(s.Number),
+		s.Size[0], s.Size[1], s.Offset[0], s.Offset[1], s.coldepth, format, s.palidx, csvField(filename))
+}
+
+// csvField quotes v when it holds a comma or a quote
+func csvField(v string) string {
+	for _, c := range v {
+		if c == ',' || c == '"' {
+			return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+		}
+	}
+	return v
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testDecoder returns a sprite of w*h pixels to call the decoders on
+func testDecoder(w, h int) *Sprite {
+	s := newSprite()
+	s.Size = [2]uint16{uint16(w), uint16(h)}
+	return s
+}
+
+func TestLz5DecodeBadReference(t *testing.T) {
+	// The first packet is a back-reference of 2 pixels, 6 pixels back, before any pixel is written
+	for _, rle := range [][]byte{{0x01, 0x41, 0x05}, {0x01, 0x00, 0x10, 0x00}} {
+		if _, err := testDecoder(8, 8).Lz5Decode(rle); err == nil || !strings.Contains(err.Error(), "back-reference") {
+			t.Errorf("% x: got error %v, want a back-reference error", rle, err)
+		}
+	}
+	// A stream cut short ends, its last byte is read again until the sprite is full or gives a bad reference.
+	// 0x21 is a run of 1 pixel of color 1, then as the next control byte it makes the 9th packet a back-reference.
+	if p, err := testDecoder(8, 1).Lz5Decode([]byte{0x00, 0x21}); err != nil || !bytes.Equal(p, bytes.Repeat([]byte{1}, 8)) {
+		t.Errorf("cut stream: got %v, error %v, want 8 pixels of color 1", p, err)
+	}
+	if p, err := testDecoder(64, 64).Lz5Decode([]byte{0x00, 0x21}); err == nil || !strings.Contains(err.Error(), "back-reference") {
+		t.Errorf("cut stream: got %v pixels, error %v, want a back-reference error", len(p), err)
+	}
+	// Through Decode the error names the sprite
+	sff := openTestSff(t, buildTestSffV2([][]uint32{testPalette(0)},
+		testSprite{group: 7, number: 3, w: 8, h: 8, format: 4, data: []byte{64, 0, 0, 0, 0x01, 0x41, 0x05}}))
+	if _, err := sff.GetSprite(7, 3).Decode(); err == nil || !strings.Contains(err.Error(), "7,3") {
+		t.Errorf("got error %v, want an error naming sprite 7,3", err)
+	}
+}
+
+// A zero-length run as the last byte used to make the PCX and RLE8 decoders loop forever
+func TestDecodeZeroRun(t *testing.T) {
+	s := testDecoder(8, 8)
+	s.rle = 8
+	if _, err := s.RlePcxDecode([]byte{0xc2, 5, 0xc0}); err == nil {
+		t.Error("PCX: no error")
+	}
+	if _, err := testDecoder(8, 8).Rle8Decode([]byte{0x42, 5, 0x40}); err == nil {
+		t.Error("RLE8: no error")
+	}
+}
+
+// FuzzDecoders checks the decoders end on any data, without panic, and fill the whole sprite when they succeed
+func FuzzDecoders(f *testing.F) {
+	pix := testPixels(16, 8, 32)
+	lz5, _ := lz5Encode(pix)
+	for _, data := range [][]byte{rle8Encode(pix), rle5Encode(pix), lz5, pcxEncode(pix, 16, 8)[128:], {0xc0}, {0x40}, {0x01, 0x41, 0x05}} {
+		f.Add(data, uint8(16), uint8(8))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, w, h uint8) {
+		if len(data) == 0 || w == 0 || h == 0 {
+			return
+		}
+		n := int(w) * int(h)
+		check := func(name string, p []byte, err error) {
+			if err == nil && len(p) != n {
+				t.Errorf("%v: got %v pixels, want %v", name, len(p), n)
+			}
+		}
+		p, err := testDecoder(int(w), int(h)).Rle8Decode(data)
+		check("RLE8", p, err)
+		check("RLE5", testDecoder(int(w), int(h)).Rle5Decode(data), nil)
+		p, err = testDecoder(int(w), int(h)).Lz5Decode(data)
+		check("LZ5", p, err)
+		s := testDecoder(int(w), int(h))
+		s.rle = int(w)
+		p, err = s.RlePcxDecode(data)
+		check("PCX", p, err)
+	})
+}
+
+// The PCX lines written by pcxEncode decode to the same pixels, see encode_test.go for the v2 formats
+func TestPcxRoundTrip(t *testing.T) {
+	pix := testPixels(16, 8, 32)
+	pcx, err := rlePcxLines(pcxEncode(pix, 16, 8)[128:], 16, 8, 16)
+	if err != nil || !bytes.Equal(pcx, pix) {
+		t.Errorf("PCX: pixels differ, %v", err)
+	}
+}
+
+// benchPixels are the pixels of the benchmark sprite, 256x256 in 32 colors so LZ5 can encode them
+var benchPixels = testPixels(256, 256, 32)
+
+// benchDecode reports the speed of decode in MB/s of decoded pixels
+func benchDecode(b *testing.B, decode func(s *Sprite) ([]byte, error)) {
+	s := newSprite()
+	s.Size = [2]uint16{256, 256}
+	b.SetBytes(int64(len(benchPixels)))
+	for i := 0; i < b.N; i++ {
+		if _, err := decode(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRle8Decode(b *testing.B) {
+	data := rle8Encode(benchPixels)
+	benchDecode(b, func(s *Sprite) ([]byte, error) { return s.Rle8Decode(data) })
+}
+
+func BenchmarkRle5Decode(b *testing.B) {
+	data := rle5Encode(benchPixels)
+	benchDecode(b, func(s *Sprite) ([]byte, error) { return s.Rle5Decode(data), nil })
+}
+
+func BenchmarkLz5Decode(b *testing.B) {
+	data, _ := lz5Encode(benchPixels)
+	benchDecode(b, func(s *Sprite) ([]byte, error) { return s.Lz5Decode(data) })
+}
+
+func BenchmarkPcxDecode(b *testing.B) {
+	data := pcxEncode(benchPixels, 256, 256)[128:]
+	benchDecode(b, func(s *Sprite) ([]byte, error) { return rlePcxLines(data, 256, 256, 256) })
+}
+
+// BenchmarkDecodeSff decodes every sprite of a v2 file in each format, as a file of a character would mix them
+func BenchmarkDecodeSff(b *testing.B) {
+	var sprites []testSprite
+	for i, format := range []byte{0, 2, 3, 4, 2, 3, 4, 4} {
+		sprites = append(sprites, testSprite{group: int16(i), w: 256, h: 256, pix: benchPixels, format: format})
+	}
+	sff := openTestSff(b, buildTestSffV2([][]uint32{testPalette(0)}, sprites...))
+	b.SetBytes(int64(len(sprites) * len(benchPixels)))
+	for i := 0; i < b.N; i++ {
+		for _, s := range sff.spriteList {
+			if _, err := s.Decode(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*len(sprites))/b.Elapsed().Seconds(), "sprites/s")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/leonkasovan/sffcli/packages/physfs"
+)
+
+// IniFile holds key=value pairs grouped by [section]. Section and key names are
+// stored in lower case because Mugen treats them case-insensitively.
+type IniFile map[string]map[string]string
+
+// Get returns the value of key in section, or empty string if not present.
+func (ini IniFile) Get(section, key string) string {
+	if sec, ok := ini[strings.ToLower(section)]; ok {
+		return sec[strings.ToLower(key)]
+	}
+	return ""
+}
+
+// parseIni reads a minimal ini-style file: [section] headers, key = value lines and ';' comments.
+func parseIni(filename string) (IniFile, error) {
+	data, err := physfs.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %v", filename, err)
+	}
+	ini := make(IniFile)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, ";"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if ini[section] == nil {
+				ini[section] = make(map[string]string)
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if ini[section] == nil {
+			ini[section] = make(map[string]string)
+		}
+		ini[section][strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), "\"")
+	}
+	return ini, scanner.Err()
+}
+
+// CharDef is the part of a character .def file that sffcli cares about.
+type CharDef struct {
+	Filename string
+	Sprite   string   // sff file referenced by [Files] sprite
+	Anim     string   // air file referenced by [Files] anim
+	Pals     []string // act files referenced by [Files] pal1..pal12
+}
+
+// resolve converts a path written in the def into a path relative to the current directory.
+func (d *CharDef) resolve(name string) string {
+	if name == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(d.Filename), strings.Replace(name, "\\", "/", -1))
+}
+
+func loadCharDef(filename string) (*CharDef, error) {
+	ini, err := parseIni(filename)
+	if err != nil {
+		return nil, err
+	}
+	d := &CharDef{Filename: filename}
+	d.Sprite = d.resolve(ini.Get("Files", "sprite"))
+	d.Anim = d.resolve(ini.Get("Files", "anim"))
+	for i := 1; i <= 12; i++ {
+		if pal := ini.Get("Files", fmt.Sprintf("pal%d", i)); pal != "" {
+			d.Pals = append(d.Pals, d.resolve(pal))
+		}
+	}
+	if d.Sprite == "" {
+		return nil, fmt.Errorf("No sprite file in [Files] section of %v", filename)
+	}
+	return d, nil
+}
+
+/*
+loadActionNames reads an air file and maps every sprite group,number to the action using it.
+The action name is taken from the comment right above [Begin Action N], e.g.
+
+	; Standing
+	[Begin Action 0]
+	0,0, 0,0, 10
+
+Actions without comment are named "action N". The first action referencing a sprite wins.
+*/
+func loadActionNames(filename string) (map[[2]int16]string, error) {
+	data, err := physfs.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %v", filename, err)
+	}
+	names := make(map[[2]int16]string)
+	comment, action := "", ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == ';' {
+			comment = strings.TrimSpace(strings.TrimLeft(line, ";"))
+			continue
+		}
+		if idx := strings.Index(line, ";"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		lower := strings.ToLower(line)
+		if strings.HasPrefix(lower, "[begin action") && strings.HasSuffix(lower, "]") {
+			action = sanitizeName(comment)
+			if action == "" {
+				action = "action " + strings.TrimSpace(lower[len("[begin action"):len(lower)-1])
+			}
+			comment = ""
+			continue
+		}
+		comment = ""
+		if action == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 5 {
+			continue
+		}
+		g, err1 := strconv.Atoi(strings.TrimSpace(fields[0]))
+		n, err2 := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		key := [...]int16{int16(g), int16(n)}
+		if _, ok := names[key]; !ok {
+			names[key] = action
+		}
+	}
+	return names, scanner.Err()
+}
+
+// sanitizeName keeps only characters that are safe in a filename on every platform.
+func sanitizeName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ' ' || r == '-' || r == '_' {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// extractCharDef extracts the sff of a character def, with sprites named by the actions of its air file
+func extractCharDef(def *CharDef, cmdSavePalette bool) {
+	actionNames = nil
+	if def.Anim != "" {
+		var err error
+		if actionNames, err = loadActionNames(def.Anim); err != nil {
+			fmt.Println(err)
+		}
+	}
+	sff, err := extractSff(def.Sprite, cmdSavePalette)
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		printSummary(sff)
+	}
+	if len(def.Pals) > 0 {
+		fmt.Printf("Palettes referenced by %v: %v\n", def.Filename, strings.Join(def.Pals, ", "))
+	}
+	actionNames = nil
+}
@@ -0,0 +1,158 @@
+package main
+
+// The encoders below write the SFF v2 sprite formats read by Rle8Decode, Rle5Decode and Lz5Decode.
+// They are greedy, the data they produce decodes to the same pixels but is not always the smallest possible.
+
+// rle8Encode encodes the palette indices px as RLE8. Runs are cut at 63 pixels, a single pixel is
+// stored as is unless its value looks like a run header.
+func rle8Encode(px []byte) []byte {
+	out := make([]byte, 0, len(px))
+	for j := 0; j < len(px); {
+		c, n := px[j], 1
+		for j+n < len(px) && px[j+n] == c && n < 63 {
+			n++
+		}
+		if n == 1 && c&0xc0 != 0x40 {
+			out = append(out, c)
+		} else {
+			out = append(out, 0x40|byte(n), c)
+		}
+		j += n
+	}
+	return out
+}
+
+// rle5Encode encodes the palette indices px as RLE5. A packet starts with a run of up to 256 pixels
+// of any color, followed by up to 127 runs of up to 8 pixels of colors 0 to 31.
+func rle5Encode(px []byte) []byte {
+	run := func(j, limit int) int {
+		n := 1
+		for j+n < len(px) && px[j+n] == px[j] && n < limit {
+			n++
+		}
+		return n
+	}
+	out := make([]byte, 0, len(px))
+	for j := 0; j < len(px); {
+		c, n := px[j], run(j, 256)
+		out = append(out, byte(n-1))
+		head := len(out)
+		if c != 0 {
+			out = append(out, 0x80, c)
+		} else {
+			out = append(out, 0)
+		}
+		j += n
+		for dl := 0; j < len(px) && px[j] < 32 && dl < 127; dl++ {
+			// A long run is cheaper as the first run of the next packet
+			if n = run(j, 17); n > 16 {
+				break
+			}
+			n = min(n, 8)
+			out = append(out, byte(n-1)<<5|px[j])
+			out[head]++
+			j += n
+		}
+	}
+	return out
+}
+
+// lz5Encode encodes the palette indices px as LZ5. Its runs only hold colors 0 to 31, so px with higher
+// indices cannot be encoded and false is returned. Matches are looked up in the previous 1024 pixels.
+func lz5Encode(px []byte) ([]byte, bool) {
+	for _, c := range px {
+		if c >= 32 {
+			return nil, false
+		}
+	}
+	const window, maxLen, maxCandidates = 1024, 258, 64
+	// head and chain link the positions starting with the same two pixels, most recent first
+	head := make(map[uint16]int)
+	chain := make([]int, len(px))
+	add := func(j int) {
+		if j+1 < len(px) {
+			k := uint16(px[j])<<8 | uint16(px[j+1])
+			if h, ok := head[k]; ok {
+				chain[j] = h
+			} else {
+				chain[j] = -1
+			}
+			head[k] = j
+		}
+	}
+	match := func(j int) (int, int) {
+		if j+1 >= len(px) {
+			return 0, 0
+		}
+		h, ok := head[uint16(px[j])<<8|uint16(px[j+1])]
+		bestLen, bestOfs := 0, 0
+		for n := 0; ok && h >= 0 && j-h <= window && n < maxCandidates; n++ {
+			l := 0
+			for j+l < len(px) && px[h+l] == px[j+l] && l < maxLen {
+				l++
+			}
+			// A short reference reaches 256 pixels back, a longer offset costs one more byte
+			if l > bestLen && (l >= 3 || j-h <= 256) {
+				bestLen, bestOfs = l, j-h
+			}
+			h = chain[h]
+		}
+		return bestLen, bestOfs
+	}
+
+	out := make([]byte, 0, len(px))
+	ctrl, packets := 0, 0
+	var short [3]int // positions of the pending short references sharing their high bits with the next one
+	numShort := 0
+	for j := 0; j < len(px); {
+		if packets%8 == 0 {
+			ctrl = len(out)
+			out = append(out, 0)
+		}
+		r := 1
+		for j+r < len(px) && px[j+r] == px[j] && r < 263 {
+			r++
+		}
+		l, ofs := match(j)
+		// Compare the pixels written per byte of a run and of a back-reference
+		runCost, refCost := 1, 3
+		if r >= 8 {
+			runCost = 2
+		} else {
+			r = min(r, 7)
+		}
+		if l <= 64 && ofs <= 256 {
+			refCost = 2
+		}
+		n := r
+		if l >= 2 && l*runCost > r*refCost {
+			n = l
+			out[ctrl] |= 1 << (packets % 8)
+			if refCost == 3 {
+				out = append(out, byte((ofs-1)>>8)<<6, byte(ofs-1), byte(n-3))
+			} else if numShort < 3 {
+				short[numShort] = len(out)
+				numShort++
+				out = append(out, byte(n-1), byte(ofs-1))
+			} else {
+				// The fourth short reference takes its offset from the high bits of the last four
+				rb := byte(ofs - 1)
+				for k, pos := range short {
+					out[pos] |= rb << (2 * k) & 0xc0
+				}
+				out = append(out, byte(n-1)|rb<<6)
+				numShort = 0
+			}
+		} else if r >= 8 {
+			out = append(out, px[j], byte(r-8))
+		} else {
+			out = append(out, byte(r)<<5|px[j])
+		}
+		for k := 0; k < n; k++ {
+			add(j + k)
+		}
+		j += n
+		packets++
+	}
+	return out, true
+}
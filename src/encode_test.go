@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encodeTestPixels are the pixels the encoders are tested on, each with runs and colors that need a special encoding
+var encodeTestPixels = map[string][]byte{
+	"mixed":       testPixels(37, 11, 32),
+	"single":      {5},
+	"long run":    bytes.Repeat([]byte{3}, 1000),
+	"run of 0":    bytes.Repeat([]byte{0}, 300),
+	"header-like": {0x40, 0x41, 0x7f, 0x7f, 0xc0, 0x3f},
+	"far match":   append(testPixels(20, 20, 32), testPixels(20, 20, 32)...),
+	"repeated":    bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, 200),
+}
+
+func TestRle8Encode(t *testing.T) {
+	for name, px := range encodeTestPixels {
+		got, err := testDecoder(len(px), 1).Rle8Decode(rle8Encode(px))
+		if err != nil || !bytes.Equal(got, px) {
+			t.Errorf("%v: pixels differ, %v", name, err)
+		}
+	}
+}
+
+func TestRle5Encode(t *testing.T) {
+	for name, px := range encodeTestPixels {
+		if got := testDecoder(len(px), 1).Rle5Decode(rle5Encode(px)); !bytes.Equal(got, px) {
+			t.Errorf("%v: pixels differ", name)
+		}
+	}
+}
+
+func TestLz5Encode(t *testing.T) {
+	for name, px := range encodeTestPixels {
+		data, ok := lz5Encode(px)
+		if name == "header-like" {
+			if ok {
+				t.Errorf("%v: encoded colors above 31", name)
+			}
+			continue
+		}
+		got, err := testDecoder(len(px), 1).Lz5Decode(data)
+		if !ok || err != nil || !bytes.Equal(got, px) {
+			t.Errorf("%v: pixels differ, %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import "fmt"
+
+// extractSpritePalette writes the palette of sprite group,number (gn) of an sff to the ACT file actFilename
+func extractSpritePalette(filename, gn, actFilename string) error {
+	g, n, err := parseGroupNumber(gn)
+	if err != nil {
+		return err
+	}
+	sff, err := OpenSff(filename)
+	if err != nil {
+		return err
+	}
+	s := sff.GetSprite(g, n)
+	if s == nil {
+		return fmt.Errorf("Sprite %v,%v not found in %v", groupNo(g), groupNo(n), filename)
+	}
+	colors := sff.numColors(s)
+	if colors == 0 {
+		return fmt.Errorf("Sprite %v,%v of %v is true-color and has no palette", groupNo(g), groupNo(n), filename)
+	}
+	pal := s.GetPal(&sff.palList)
+	if err := savePalette(pal[:min(colors, len(pal))], actFilename); err != nil {
+		return err
+	}
+	fmt.Printf("Palette of sprite %v,%v saved to %v\n", groupNo(g), groupNo(n), actFilename)
+	return nil
+}
+
+// listPalettes prints the group,number, number of colors and link of every palette header of an SFF v2
+func listPalettes(filename string) error {
+	sff, err := OpenSff(filename)
+	if err != nil {
+		return err
+	}
+	if sff.header.Ver0 == 1 {
+		return fmt.Errorf("%v is SFF v1, its palettes have no group,number", filename)
+	}
+	pl := &sff.palList
+	for i, gn := range pl.headers {
+		idx := pl.PalTable[gn]
+		fmt.Printf("%v,%v %v colors", groupNo(gn[0]), groupNo(gn[1]), pl.numcols[gn])
+		if idx != i && idx >= 0 && idx < len(pl.headers) {
+			if dst := pl.headers[idx]; dst == gn {
+				fmt.Print(", duplicated")
+			} else {
+				fmt.Printf(", linked to %v,%v", groupNo(dst[0]), groupNo(dst[1]))
+			}
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// extractPaletteGroupNumber writes SFF v2 palette group,number (gn) of an sff to the ACT file actFilename
+func extractPaletteGroupNumber(filename, gn, actFilename string) error {
+	g, n, err := parseGroupNumber(gn)
+	if err != nil {
+		return err
+	}
+	sff, err := OpenSff(filename)
+	if err != nil {
+		return err
+	}
+	key := [...]int16{g, n}
+	found := false
+	for _, h := range sff.palList.headers {
+		found = found || h == key
+	}
+	idx, ok := sff.palList.PalTable[key]
+	if !found || !ok || idx < 0 {
+		return fmt.Errorf("Palette %v,%v not found in %v", groupNo(g), groupNo(n), filename)
+	}
+	pal := sff.palList.Get(idx)
+	colors := sff.palList.numcols[key]
+	if colors <= 0 || colors > len(pal) {
+		colors = len(pal)
+	}
+	if err := savePalette(pal[:colors], actFilename); err != nil {
+		return err
+	}
+	fmt.Printf("Palette %v,%v saved to %v\n", groupNo(g), groupNo(n), actFilename)
+	return nil
+}
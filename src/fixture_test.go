@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// testSprite is a sprite of an sff synthesized by buildTestSffV1 or buildTestSffV2
+type testSprite struct {
+	group, number int16
+	w, h          int
+	pix           []byte // w*h palette indices, nil for a sprite linked to sprite link
+	link          int
+	axis          [2]int16
+
+	samePal bool     // v1: flagged as using the palette of the previous sprite, no palette is stored unless pal is set
+	pal     []uint32 // v1: palette stored after the PCX data, testPalette(0) when nil
+
+	format byte   // v2: 0 raw, 2 RLE8, 3 RLE5 or 4 LZ5
+	palidx int    // v2: index of the palette of the sprite
+	data   []byte // v2: stored as is instead of the encoded pix, for PNG or malformed sprites
+}
+
+// testPalette returns 256 opaque colors but the transparent index 0, color i is (i, seed, 255-i)
+func testPalette(seed byte) []uint32 {
+	pal := make([]uint32, 256)
+	for i := range pal {
+		pal[i] = 0xff000000 | uint32(255-i)<<16 | uint32(seed)<<8 | uint32(i)
+	}
+	pal[0] &= 0xffffff
+	return pal
+}
+
+// testPixels returns w*h palette indices below colors, in runs and single pixels so every encoding gets used
+func testPixels(w, h, colors int) []byte {
+	pix := make([]byte, w*h)
+	for i := range pix {
+		if i/5%3 == 0 {
+			pix[i] = byte(i / 15 % colors)
+		} else {
+			pix[i] = byte((i*7 + i/w) % colors)
+		}
+	}
+	return pix
+}
+
+// pcxEncode returns the 128-byte header and the RLE lines of an 8-bit PCX image
+func pcxEncode(pix []byte, w, h int) []byte {
+	out := make([]byte, 128)
+	out[0], out[1], out[2], out[3] = 10, 5, 1, 8
+	binary.LittleEndian.PutUint16(out[8:], uint16(w-1))
+	binary.LittleEndian.PutUint16(out[10:], uint16(h-1))
+	out[65] = 1
+	binary.LittleEndian.PutUint16(out[66:], uint16(w))
+	for y := 0; y < h; y++ {
+		line := pix[y*w : (y+1)*w]
+		for x := 0; x < w; {
+			n := 1
+			for x+n < w && line[x+n] == line[x] && n < 63 {
+				n++
+			}
+			if n == 1 && line[x] < 0xc0 {
+				out = append(out, line[x])
+			} else {
+				out = append(out, 0xc0|byte(n), line[x])
+			}
+			x += n
+		}
+	}
+	return out
+}
+
+// buildTestSffV1 returns an SFF v1 file holding sprites as 8-bit RLE PCX, each followed by
+// the 0x0C marker and its palette unless it is flagged with the same palette and has none
+func buildTestSffV1(sprites ...testSprite) []byte {
+	const first = 32
+	out := make([]byte, first)
+	copy(out, "ElecbyteSpr\x00")
+	out[12], out[13], out[14], out[15] = 0, 1, 0, 1
+	binary.LittleEndian.PutUint32(out[16:], 1)
+	binary.LittleEndian.PutUint32(out[20:], uint32(len(sprites)))
+	binary.LittleEndian.PutUint32(out[24:], first)
+	binary.LittleEndian.PutUint32(out[28:], 32)
+	for i, s := range sprites {
+		var data []byte
+		if s.pix != nil {
+			data = pcxEncode(s.pix, s.w, s.h)
+			if !s.samePal || s.pal != nil {
+				pal := s.pal
+				if pal == nil {
+					pal = testPalette(0)
+				}
+				data = append(data, 0x0c)
+				for _, c := range pal {
+					data = append(data, byte(c), byte(c>>8), byte(c>>16))
+				}
+			}
+		}
+		next := 0
+		if i < len(sprites)-1 {
+			next = len(out) + 32 + len(data)
+		}
+		sub := make([]byte, 32)
+		binary.LittleEndian.PutUint32(sub, uint32(next))
+		binary.LittleEndian.PutUint32(sub[4:], uint32(len(data)))
+		binary.LittleEndian.PutUint16(sub[8:], uint16(s.axis[0]))
+		binary.LittleEndian.PutUint16(sub[10:], uint16(s.axis[1]))
+		binary.LittleEndian.PutUint16(sub[12:], uint16(s.group))
+		binary.LittleEndian.PutUint16(sub[14:], uint16(s.number))
+		binary.LittleEndian.PutUint16(sub[16:], uint16(s.link))
+		if s.samePal {
+			sub[18] = 1
+		}
+		out = append(append(out, sub...), data...)
+	}
+	return out
+}
+
+// buildTestSffV2 returns an SFF v2.01 file with the palettes pals, whose alpha is kept, and sprites
+// encoded in their format. The data of every sprite is in the ldata block.
+func buildTestSffV2(pals [][]uint32, sprites ...testSprite) []byte {
+	const first = 64
+	var ldata, palHeaders, sprHeaders []byte
+	for i, pal := range pals {
+		h := make([]byte, 16)
+		binary.LittleEndian.PutUint16(h, 1)
+		binary.LittleEndian.PutUint16(h[2:], uint16(i+1))
+		binary.LittleEndian.PutUint16(h[4:], uint16(len(pal)))
+		binary.LittleEndian.PutUint32(h[8:], uint32(len(ldata)))
+		binary.LittleEndian.PutUint32(h[12:], uint32(4*len(pal)))
+		palHeaders = append(palHeaders, h...)
+		for _, c := range pal {
+			ldata = binary.LittleEndian.AppendUint32(ldata, c)
+		}
+	}
+	for _, s := range sprites {
+		data := s.data
+		if data == nil && s.pix != nil {
+			switch s.format {
+			case 0:
+				data = s.pix
+			case 2:
+				data = rle8Encode(s.pix)
+			case 3:
+				data = rle5Encode(s.pix)
+			case 4:
+				data, _ = lz5Encode(s.pix)
+			}
+			if s.format != 0 {
+				data = append(binary.LittleEndian.AppendUint32(nil, uint32(len(s.pix))), data...)
+			}
+		}
+		h := make([]byte, 28)
+		binary.LittleEndian.PutUint16(h, uint16(s.group))
+		binary.LittleEndian.PutUint16(h[2:], uint16(s.number))
+		binary.LittleEndian.PutUint16(h[4:], uint16(s.w))
+		binary.LittleEndian.PutUint16(h[6:], uint16(s.h))
+		binary.LittleEndian.PutUint16(h[8:], uint16(s.axis[0]))
+		binary.LittleEndian.PutUint16(h[10:], uint16(s.axis[1]))
+		binary.LittleEndian.PutUint16(h[12:], uint16(s.link))
+		h[14], h[15] = s.format, 8
+		if data != nil {
+			binary.LittleEndian.PutUint32(h[16:], uint32(len(ldata)))
+			binary.LittleEndian.PutUint32(h[20:], uint32(len(data)))
+		}
+		binary.LittleEndian.PutUint16(h[24:], uint16(s.palidx))
+		sprHeaders = append(sprHeaders, h...)
+		ldata = append(ldata, data...)
+	}
+	firstPal := first + len(sprHeaders)
+	lofs := firstPal + len(palHeaders)
+	out := make([]byte, first)
+	copy(out, "ElecbyteSpr\x00")
+	out[12], out[13], out[14], out[15] = 0, 1, 0, 2
+	for i, v := range []int{first, len(sprites), firstPal, len(pals), lofs, len(ldata), lofs + len(ldata)} {
+		binary.LittleEndian.PutUint32(out[36+4*i:], uint32(v))
+	}
+	out = append(append(append(out, sprHeaders...), palHeaders...), ldata...)
+	return out
+}
+
+// openTestSff reads an sff built in memory like OpenSff, for Sprite.Decode
+func openTestSff(t testing.TB, data []byte) *Sff {
+	t.Helper()
+	sff, err := loadSff(context.Background(), bytes.NewReader(data), "test.sff", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sff
+}
+
+// extractTestSff extracts an sff built in memory into a temporary directory and returns
+// the sff and the name of its output files without extension
+func extractTestSff(t testing.TB, data []byte) (*Sff, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "test.sff")
+	sff, err := extractSffReader(bytes.NewReader(data), filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sff, sff.outbase
+}
+
+// setOption sets an option for the duration of the test
+func setOption[T any](t testing.TB, opt *T, v T) {
+	old := *opt
+	*opt = v
+	t.Cleanup(func() { *opt = old })
+}
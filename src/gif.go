@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+)
+
+// writePaletteCycleGIF renders sprite group,number (gn) of an sff once with each -pal-cycle palette
+// and writes the frames as an animated GIF that loops forever
+func writePaletteCycleGIF(filename, gn, sffName string) error {
+	if len(optPalCycle) == 0 {
+		return fmt.Errorf("Error: -gif requires the palettes of -pal-cycle")
+	}
+	g, n, err := parseGroupNumber(gn)
+	if err != nil {
+		return err
+	}
+	sff, err := OpenSff(sffName)
+	if err != nil {
+		return err
+	}
+	s := sff.GetSprite(g, n)
+	if s == nil {
+		return fmt.Errorf("Sprite %v,%v not found in %v", groupNo(g), groupNo(n), sffName)
+	}
+	img, err := s.Decode()
+	if err != nil {
+		return err
+	}
+	p, ok := img.(*image.Paletted)
+	if !ok {
+		return fmt.Errorf("Sprite %v,%v of %v is true-color and has no palette to cycle", groupNo(g), groupNo(n), sffName)
+	}
+	anim := &gif.GIF{}
+	for _, pal := range optPalCycle {
+		// Every frame shares the pixels of the sprite, only the palette changes
+		frame := *p
+		frame.Palette = genPalette(pal)
+		anim.Image = append(anim.Image, &frame)
+		anim.Delay = append(anim.Delay, optGifDelay)
+	}
+	if skipWrite(filename, len(p.Pix)*len(anim.Image)) {
+		return nil
+	}
+	fo, err := createOutputDir(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	if err := gif.EncodeAll(fo, anim); err != nil {
+		return err
+	}
+	fmt.Printf("Animated GIF %v created with %v frames of sprite %v,%v\n", filename, len(anim.Image), groupNo(g), groupNo(n))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// spriteFile returns the image file written for sprite s, or for a linked sprite without its own file
+// the file of the sprite it links to. It returns "" when neither exists.
+func (sff *Sff) spriteFile(s *Sprite) string {
+	for ; s != nil; s = s.linkedTo {
+		filename := sff.spriteFilename(s)
+		if outputExists(filename) {
+			return filename
+		}
+	}
+	return ""
+}
+
+// godotString quotes v for a Godot resource file
+func godotString(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// writeGodotResource writes "<name>.tres", a Godot 4 SpriteFrames resource with one animation per
+// sprite group, for -godot. The frames are the image files of the group's sprites by number, the
+// paths are relative to the resource, which is saved next to them or above their -split directories. SpriteFrames has no per-frame
+// offset, the axis of each sprite is in the TSV and -offsets.
+func writeGodotResource(sff *Sff) error {
+	var groups []int16
+	frames := make(map[int16][]*Sprite)
+	for _, s := range sff.spriteList {
+		if sff.spriteFile(s) == "" {
+			continue
+		}
+		if _, ok := frames[s.Group]; !ok {
+			groups = append(groups, s.Group)
+		}
+		frames[s.Group] = append(frames[s.Group], s)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groupValue(groups[i]) < groupValue(groups[j]) })
+
+	ids := make(map[string]int)
+	var ext, anims strings.Builder
+	for _, g := range groups {
+		sprites := frames[g]
+		sort.SliceStable(sprites, func(i, j int) bool { return groupValue(sprites[i].Number) < groupValue(sprites[j].Number) })
+		var list []string
+		for _, s := range sprites {
+			name, err := filepath.Rel(filepath.Dir(sff.outbase), sff.spriteFile(s))
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(name)
+			id, ok := ids[name]
+			if !ok {
+				id = len(ids) + 1
+				ids[name] = id
+				fmt.Fprintf(&ext, "[ext_resource type=\"Texture2D\" path=%v id=\"%v\"]\n", godotString(name), id)
+			}
+			list = append(list, fmt.Sprintf("{\n\"duration\": 1.0,\n\"texture\": ExtResource(\"%v\")\n}", id))
+		}
+		if anims.Len() > 0 {
+			anims.WriteString(", ")
+		}
+		fmt.Fprintf(&anims, "{\n\"frames\": [%v],\n\"loop\": true,\n\"name\": &\"%v\",\n\"speed\": 5.0\n}", strings.Join(list, ", "), groupNo(g))
+	}
+
+	var res strings.Builder
+	fmt.Fprintf(&res, "[gd_resource type=\"SpriteFrames\" load_steps=%v format=3]\n\n", len(ids)+1)
+	if ext.Len() > 0 {
+		fmt.Fprintf(&res, "%v\n", ext.String())
+	}
+	fmt.Fprintf(&res, "[resource]\nanimations = [%v]\n", anims.String())
+	filename := sff.outbase + ".tres"
+	if skipWrite(filename, res.Len()) {
+		return nil
+	}
+	if err := writeOutput(filename, []byte(res.String())); err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The animations of the Godot resource are sorted by group and their frames by number, as numbers
+func TestGodotOrder(t *testing.T) {
+	setOption(t, &optGodot, true)
+	pix := testPixels(2, 2, 32)
+	var sprites []testSprite
+	for _, gn := range [][2]int16{{100, 0}, {9, 10}, {9, 2}, {10, 0}, {-1, 0}} {
+		sprites = append(sprites, testSprite{group: gn[0], number: gn[1], w: 2, h: 2, pix: pix, format: 2})
+	}
+	data := buildTestSffV2([][]uint32{testPalette(0)}, sprites...)
+	names := regexp.MustCompile(`"name": &"(-?\d+)"`)
+	for _, tc := range []struct {
+		unsigned bool
+		want     string
+	}{{false, "-1 9 10 100"}, {true, "9 10 100 65535"}} {
+		setOption(t, &optUnsignedGroups, tc.unsigned)
+		_, outbase := extractTestSff(t, data)
+		tres, err := os.ReadFile(outbase + ".tres")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range names.FindAllStringSubmatch(string(tres), -1) {
+			got = append(got, m[1])
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("-unsigned-groups %v: got animations %v, want %v", tc.unsigned, got, tc.want)
+		}
+		if i, j := strings.Index(string(tres), "test 9 2.png"), strings.Index(string(tres), "test 9 10.png"); i < 0 || j < i {
+			t.Errorf("-unsigned-groups %v: frame 9,2 is not before 9,10", tc.unsigned)
+		}
+	}
+}
+
+func TestGodotNoOverwrite(t *testing.T) {
+	setOption(t, &optGodot, true)
+	setOption(t, &optNoOverwrite, true)
+	filename := filepath.Join(t.TempDir(), "test.sff")
+	tres := filepath.Join(filepath.Dir(filename), "test.tres")
+	if err := os.WriteFile(tres, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data := buildTestSffV2([][]uint32{testPalette(0)}, testSprite{w: 2, h: 2, pix: testPixels(2, 2, 32), format: 2})
+	if _, err := extractSffReader(bytes.NewReader(data), filename, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(tres); string(got) != "kept" {
+		t.Errorf("-no-overwrite: the existing resource was replaced by %q", got)
+	}
+}
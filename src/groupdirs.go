@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// groupDir returns the directory -group-dirs writes the sprites of group g to,
+// "<name>/<group>" next to the sff output or its -split directory
+func groupDir(outbase string, g int16) string {
+	return filepath.Join(outbase, groupNo(g))
+}
+
+// makeGroupDir creates the -group-dirs directory of sprite s once per sff
+func (sff *Sff) makeGroupDir(s *Sprite) error {
+	return sff.makeDir(groupDir(sff.spriteOutbase(s), s.Group))
+}
+
+// makeDir creates the output directory dir, once per sff
+func (sff *Sff) makeDir(dir string) error {
+	if sff.dirs[dir] {
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("Error creating directory %v: %v", dir, err)
+	}
+	sff.dirs[dir] = true
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+)
+
+// hashWriter receives one "group,number,crc32" line per sprite when -hashes is used
+var hashWriter io.Writer
+
+// imageCRC returns the crc32 of the pixel data and palette of img.
+// It does not depend on how the image is compressed on disk.
+func imageCRC(img image.Image) uint32 {
+	crc := crc32.NewIEEE()
+	b := img.Bounds()
+	if p, ok := img.(*image.Paletted); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			crc.Write(p.Pix[p.PixOffset(b.Min.X, y):p.PixOffset(b.Max.X, y)])
+		}
+		for _, c := range p.Palette {
+			c := straightColor(c)
+			crc.Write([]byte{c.R, c.G, c.B, c.A})
+		}
+		return crc.Sum32()
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			crc.Write([]byte{c.R, c.G, c.B, c.A})
+		}
+	}
+	return crc.Sum32()
+}
+
+func writeSpriteHash(s *Sprite, img image.Image) {
+	fmt.Fprintf(hashWriter, "%v,%v,%08x\n", groupNo(s.Group), groupNo(s.Number), imageCRC(img))
+}
@@ -0,0 +1,9 @@
+package main
+
+import "image"
+
+// OnSprite, when set, is called with the decoded image of every saved sprite after the -crop, -trim,
+// -scale and -flip transforms and before it is written. The image can be changed in place, for a
+// watermark or a recolor, and the changes are saved for that sprite only, with -write-linked the
+// sprites linked to it get their own call. An error stops the extraction of the sff file.
+var OnSprite func(s *Sprite, img image.Image) error
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+)
+
+// The changes of OnSprite to a sprite are not saved for the sprites linked to it with -write-linked
+func TestOnSpriteLinked(t *testing.T) {
+	setOption(t, &optWriteLinked, true)
+	setOption(t, &OnSprite, func(s *Sprite, img image.Image) error {
+		if s.Number == 0 {
+			clear(img.(*image.Paletted).Pix)
+		}
+		return nil
+	})
+	pix := testPixels(6, 5, 32)
+	sff, _ := extractTestSff(t, buildTestSffV2([][]uint32{testPalette(0)},
+		testSprite{number: 0, w: 6, h: 5, pix: pix, format: 2},
+		testSprite{number: 1, link: 0},
+	))
+	for number, want := range [][]byte{make([]byte, len(pix)), pix} {
+		f, err := os.Open(sff.spriteFilename(sff.GetSprite(0, int16(number))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(img.(*image.Paletted).Pix, want) {
+			t.Errorf("sprite 0,%v: pixels differ", number)
+		}
+	}
+}
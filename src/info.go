@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/leonkasovan/sffcli/packages/physfs"
+)
+
+// formatName returns the name of an SFF v2 sprite format
+func formatName(format int) string {
+	switch format {
+	case 0:
+		return "raw"
+	case 2:
+		return "RLE8"
+	case 3:
+		return "RLE5"
+	case 4:
+		return "LZ5"
+	case 10:
+		return "PNG8"
+	case 11:
+		return "PNG24"
+	case 12:
+		return "PNG32"
+	}
+	return fmt.Sprintf("unknown(%v)", format)
+}
+
+// printSffInfo prints the header, palettes and sprite statistics of an SFF without extracting anything
+func printSffInfo(filename string) error {
+	f := physfs.OpenRead(filename)
+	if f == nil {
+		return fmt.Errorf("File not found: %v", filename)
+	}
+	defer f.Close()
+	var h SffHeader
+	var lofs, tofs uint32
+	if err := h.Read(f, &lofs, &tofs); err != nil {
+		return err
+	}
+	fmt.Printf("%v\n", filename)
+	fmt.Printf("  Version                : %d.%d.%d.%d\n", h.Ver0, h.Ver1, h.Ver2, h.Ver3)
+	fmt.Printf("  First sprite header    : 0x%08x\n", h.FirstSpriteHeaderOffset)
+	fmt.Printf("  Number of sprites      : %v\n", h.NumberOfSprites)
+	if h.Ver0 != 1 {
+		fmt.Printf("  First palette header   : 0x%08x\n", h.FirstPaletteHeaderOffset)
+		fmt.Printf("  Number of palettes     : %v\n", h.NumberOfPalettes)
+		fmt.Printf("  Literal data offset    : 0x%08x\n", lofs)
+		fmt.Printf("  Translated data offset : 0x%08x\n", tofs)
+
+		unique := 0
+		for i := 0; i < int(h.NumberOfPalettes); i++ {
+			f.Seek(int64(h.FirstPaletteHeaderOffset)+int64(i*16), 0)
+			var gn [3]int16
+			var link uint16
+			var ofs, siz uint32
+			if err := binary.Read(f, binary.LittleEndian, gn[:]); err != nil {
+				return err
+			}
+			binary.Read(f, binary.LittleEndian, &link)
+			binary.Read(f, binary.LittleEndian, &ofs)
+			if err := binary.Read(f, binary.LittleEndian, &siz); err != nil {
+				return err
+			}
+			if siz != 0 {
+				unique++
+			}
+		}
+		fmt.Printf("  Unique palettes        : %v\n", unique)
+	}
+
+	formats := make(map[string]int)
+	linked := 0
+	var minW, minH, maxW, maxH uint16
+	first := true
+	shofs := int64(h.FirstSpriteHeaderOffset)
+	for i := 0; i < int(h.NumberOfSprites); i++ {
+		f.Seek(shofs, 0)
+		s := newSprite()
+		var xofs, size uint32
+		var link uint16
+		var err error
+		if h.Ver0 == 1 {
+			if err = s.readHeader(f, &xofs, &size, &link); err == nil && size != 0 {
+				err = s.readPcxHeader(f, shofs+32)
+			}
+			shofs = int64(xofs)
+		} else {
+			err = s.readHeaderV2(f, &xofs, &size, lofs, tofs, &link)
+			shofs += 28
+		}
+		if errors.Is(err, errUnsupportedFormat) {
+			formats["unsupported"]++
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Sprite %v: %v", i, err)
+		}
+		if size == 0 {
+			linked++
+			continue
+		}
+		if h.Ver0 == 1 && s.planes == 3 {
+			formats["PCX24"]++
+		} else if h.Ver0 == 1 {
+			formats["PCX"]++
+		} else {
+			formats[formatName(-s.rle)]++
+		}
+		if first || s.Size[0] < minW {
+			minW = s.Size[0]
+		}
+		if first || s.Size[1] < minH {
+			minH = s.Size[1]
+		}
+		maxW = max(maxW, s.Size[0])
+		maxH = max(maxH, s.Size[1])
+		first = false
+	}
+	fmt.Printf("  Linked sprites         : %v\n", linked)
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-23v: %v\n", name+" sprites", formats[name])
+	}
+	if !first {
+		fmt.Printf("  Min sprite size        : %vx%v\n", minW, minH)
+		fmt.Printf("  Max sprite size        : %vx%v\n", maxW, maxH)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+)
+
+// interrupted is set by the first Ctrl-C, extraction stops once the sprite being written is done
+var interrupted atomic.Bool
+
+// handleInterrupt lets the first Ctrl-C finish the current sprite, the side files and the summary
+// instead of leaving a half-written image, a second Ctrl-C quits at once
+func handleInterrupt() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		interrupted.Store(true)
+		fmt.Println("Interrupted, finishing the current sprite (press Ctrl-C again to quit now)")
+		<-c
+		os.Exit(130)
+	}()
+}
@@ -2,46 +2,36 @@
  SFF CLI tool to extract sprites (into PNG format) and palettes (into ACT format) from SFF files
  Usage: sffcli.exe <sff_file>
  Example: sffcli.exe chars.sff
- Build windows: go build -trimpath -ldflags="-s -w" -o sffcli.exe .\src\
- Build linux: go build -trimpath -ldflags="-s -w" -o sffcli src/main.go
+ Build: make go_release, or go build with the list of src/*.go files
+ (src also holds the C++ tool, so the directory cannot be built as a Go package)
+ Build windows: go build -trimpath -ldflags="-s -w" -o sffcli.exe (Get-ChildItem src\*.go)
+ Build linux: go build -trimpath -ldflags="-s -w" -o sffcli src/*.go
+ Test: go test src/*.go
 */
 
 package main
 
-/*
-// Windows Build Tags
-#cgo windows CFLAGS: -D_WIN32
-#cgo windows LDFLAGS: -lgdi32 -lz
-
-// Linux Build Tags
-#cgo linux CFLAGS: -D__linux -D__linux__
-#cgo linux LDFLAGS: -lm -lz
-
-#include "pack.c"
-#include "libpng/png.c"
-#include "libpng/pngerror.c"
-#include "libpng/pngmem.c"
-#include "libpng/pngwrite.c"
-#include "libpng/pngtrans.c"
-#include "libpng/pngwutil.c"
-#include "libpng/pngset.c"
-#include "libpng/pngwio.c"
-#include "libpng/pngwtran.c"
-#include "libpng/pngget.c"
-*/
-import "C"
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	// "unsafe"
 
 	"github.com/leonkasovan/sffcli/packages/physfs"
@@ -49,6 +39,73 @@ import (
 
 const MaxPalNo = 32
 
+// Command line options
+var (
+	actionNames         map[[2]int16]string // sprite group,number => action name, loaded via -def
+	spriteNames         map[[2]int16]string // sprite group,number => name, loaded via -names
+	groupNames          map[int16]string    // sprite group => name of its sprites without their own -names row
+	optTransparentIndex int                 // palette index used as transparent color
+	optTrim             bool                // crop transparent borders of sprites
+	optFormat           = "png"             // output image format: png, tga or tiff
+	optSingle           string              // filename of the multi-page tiff holding all sprites
+	optContactSheet     string              // filename of the contact sheet of all sprites
+	optContactCols      = 10                // number of columns in the contact sheet
+	optUnsignedGroups   bool                // print group and number as uint16
+	optRemap            []paletteRemap      // palettes redirected before saving sprites
+	optApplyPal         []uint32            // palette used for every sprite instead of its own
+	optSharedPal        []uint32            // v1: palette of sprites flagged as using the same palette
+	optPaletteBank      int                 // player palette 1..MaxPalNo used instead of palette 1,1
+	optUniformPal       bool                // draw every sprite with palette 1,1 (or the -palette bank)
+	optV1PalAtEnd       bool                // v1: read the palette at the end of sprites flagged with the same palette
+	optOutputDir        string              // output directory, the input directory layout is mirrored below it
+	optRecursive        bool                // search sff files in subdirectories too
+	optFileJobs         = 0                 // number of sff files of the directory extracted at the same time, 0 means one per CPU
+	optFlattenDir       string              // output directory holding the files of every sff without subdirectories
+	optNoOverwrite      bool                // keep output files that already exist
+	optDryRun           bool                // only report the files that would be written
+	optSkipEmpty        bool                // leave zero-size sprites without valid link out of the sprite list
+	optRangeStart       = 0                 // first sprite index decoded
+	optRangeEnd         = -1                // sprite index after the last one decoded, -1 means up to the last sprite
+	optPalCombined      string              // filename of the single file holding all unique palettes
+	optPalSwatch        bool                // also save every palette as a PNG of color cells
+	optNoACT            bool                // write no ACT file, even with -pal or -quantize
+	optPalLinked        bool                // SFF v2, also save linked palettes as a copy of the palette they link to
+	optPalCycle         [][]uint32          // palettes of the -gif frames, in order
+	optGifDelay         = 10                // -gif frame delay in 1/100 s
+	optWriteLinked      bool                // write linked sprites as their own file with the pixels of the sprite they link to
+	optSkipLinked       bool                // write no file for linked sprites, only a row naming the linked sprite in the TSV
+	optScale            = 1                 // enlarge sprites by this factor with nearest neighbor
+	optFlip             string              // mirror sprites: h (left-right), v (top-bottom) or both
+	optPassword         string              // password of encrypted zip entries in -archive
+	optStrict           bool                // fail on a sprite header outside the file or an unsupported sprite instead of skipping
+	optForceVersion     byte                // 1 or 2: parse every sff as this major version whatever its version bytes say, 0 to trust them
+	optQuantize         bool                // convert true-color sprites to 256 colors
+	optQuantizeQuality  = 10                // 1..10, share of the pixels sampled to build the -quantize palette
+	optIndexPalette     bool                // map true-color sprites to the colors of their sff palette
+	optPNG16            bool                // write true-color PNG with 16 bits per channel
+	optPremultiply      bool                // write true-color images with the color channels multiplied by alpha
+	optBackground       *color.NRGBA        // color transparent pixels are filled with, nil keeps the alpha channel
+	optCrop             *image.Rectangle    // region of every sprite to extract, nil for the whole sprite
+	optDiffDir          string              // directory -compare writes an image of every changed sprite to
+	optGroupDirs        bool                // write the sprites of every group into their own directory
+	optPalFormat        = "act"             // file format of the saved palettes: act or png
+	optKeepPCX          bool                // v1: also write the PCX data of every sprite as stored in the sff
+	optKeepRaw          bool                // v2: also write the RLE8, RLE5 and LZ5 data of every sprite as stored in the sff
+	optTRNS             bool                // indexed PNG: opaque palette, only the transparent index is marked in tRNS
+	optMinSize          [2]int              // sprites narrower or shorter than this are not saved
+	optSplit            [][2]int            // group ranges start..end, the sprites of each are saved into their own directory
+	optMaxSize          [2]int              // sprites wider or taller than this are not saved, 0 means no limit
+	optStats            bool                // print the compression ratio of each sprite format at the end
+	optBestFormat       bool                // print the size of every indexed sprite as RLE8, RLE5 and LZ5
+	optGodot            bool                // also write a Godot SpriteFrames resource per sff, one animation per sprite group
+	optMaxDim           = 8192              // v1: largest PCX width or height accepted, bigger means a corrupt header
+	optMaxPixels        = 16 << 20          // largest width*height decoded, 0 means no limit
+	optTimeout          time.Duration       // longest extraction of one sff file, 0 means no limit
+	optThumbs           int                 // also save thumbnails of at most this many pixels per side, 0 for none
+	dryRunFiles         int
+	dryRunBytes         int64
+)
+
 type Texture interface {
 	Dummy() bool
 }
@@ -80,6 +137,8 @@ type PaletteList struct {
 	PalTable   map[[2]int16]int
 	numcols    map[[2]int16]int
 	PalTex     []Texture
+
+	headers [][2]int16 // SFF v2: group,number of every palette header, in file order
 }
 
 func (pl *PaletteList) init() {
@@ -88,6 +147,7 @@ func (pl *PaletteList) init() {
 	pl.PalTable = make(map[[2]int16]int)
 	pl.numcols = make(map[[2]int16]int)
 	pl.PalTex = nil
+	pl.headers = nil
 }
 
 func (pl *PaletteList) SetSource(i int, p []uint32) {
@@ -120,6 +180,11 @@ func (pl *PaletteList) Get(i int) []uint32 {
 func (pl *PaletteList) Remap(source int, destination int) {
 	pl.paletteMap[source] = destination
 }
+
+// Has reports whether palette index i refers to a palette, one from a corrupt sprite header may not
+func (pl *PaletteList) Has(i int) bool {
+	return i >= 0 && i < len(pl.paletteMap) && pl.paletteMap[i] < len(pl.palettes) && pl.palettes[pl.paletteMap[i]] != nil
+}
 func (pl *PaletteList) ResetRemap() {
 	for i := range pl.paletteMap {
 		pl.paletteMap[i] = i
@@ -131,6 +196,18 @@ func (pl *PaletteList) GetPalMap() []int {
 	return pm
 }
 
+// NumColors returns the number of colors declared by the SFF v2 headers of palette i, 256 when unknown.
+// Linked headers share the palette data, the smallest count wins.
+func (pl *PaletteList) NumColors(i int) int {
+	n := 256
+	for gn, idx := range pl.PalTable {
+		if c := pl.numcols[gn]; idx == pl.paletteMap[i] && c > 0 {
+			n = min(n, c)
+		}
+	}
+	return n
+}
+
 func (pl *PaletteList) SwapPalMap(palMap *[]int) bool {
 	if len(*palMap) != len(pl.paletteMap) {
 		return false
@@ -171,6 +248,10 @@ func (sh *SffHeader) Read(r io.Reader, lofs *uint32, tofs *uint32) error {
 	if err := read(&sh.Ver0); err != nil {
 		return err
 	}
+	if optForceVersion != 0 && sh.Ver0 != optForceVersion {
+		fmt.Printf("Warning: SFF version %d.%d.%d.%d read as v%v (-force-version)\n", sh.Ver0, sh.Ver1, sh.Ver2, sh.Ver3, optForceVersion)
+		sh.Ver0 = optForceVersion
+	}
 	var dummy uint32
 	if err := read(&dummy); err != nil {
 		return err
@@ -232,6 +313,93 @@ type Sprite struct {
 	coldepth byte
 	paltemp  []uint32
 	PalTex   Texture
+
+	index      int    // position in the sff file
+	dup        bool   // an earlier sprite in the file has the same group,number
+	data       []byte // decoded indices or embedded PNG kept for -write-linked
+	compressed []byte // sprite data as stored in the file, kept by OpenSff for Decode
+
+	linkedTo *Sprite // zero-size sprite: the sprite whose pixels it shares
+
+	planes byte // SFF v1: color planes of the PCX, 3 for a 24-bit sprite
+}
+
+// Image returns the decoded pixels of an indexed sprite as an *image.Paletted sharing them, with the
+// palette the sprite is saved with, cut to the colors declared by its header unless the pixels use more
+// of them. The pixels are held while the sprite is saved, and afterwards with -write-linked. It returns
+// nil when s holds no decoded indices, use Decode for the sprites of OpenSff.
+func (s *Sprite) Image(pl *PaletteList) image.Image {
+	if s.data == nil || -s.rle >= 10 {
+		return nil
+	}
+	pal := s.outputPal(pl)
+	if n := s.numColors(pl); n < len(pal) {
+		for _, c := range s.data {
+			n = max(n, int(c)+1)
+		}
+		pal = pal[:min(n, len(pal))]
+	}
+	img := image.NewPaletted(image.Rect(0, 0, int(s.Size[0]), int(s.Size[1])), genPalette(pal))
+	img.Pix = s.data
+	return img
+}
+
+// Decode returns the image of a sprite of an sff opened with OpenSff.
+// Indexed sprites are returned as *image.Paletted with the palette of the sprite.
+func (s *Sprite) Decode() (image.Image, error) {
+	if s.compressed == nil {
+		return nil, fmt.Errorf("Sprite %v,%v has no data", s.Group, s.Number)
+	}
+	if err := s.checkPixels(); err != nil {
+		return nil, fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+	}
+	var px []byte
+	var err error
+	switch {
+	case s.planes == 3:
+		img, err := s.pcx24Image(s.compressed)
+		if err != nil {
+			return nil, fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+		}
+		return img, nil
+	case s.rle > 0:
+		// Not RlePcxDecode, which marks the sprite as decoded and would make a second Decode return RLE bytes
+		if len(s.compressed) > 0 {
+			px, err = rlePcxLines(s.compressed, int(s.Size[0]), int(s.Size[1]), s.rle)
+		}
+	case s.rle == 0 && s.coldepth <= 8:
+		px = s.compressed
+	case -s.rle >= 2 && -s.rle <= 4 && len(s.compressed) >= 4:
+		switch -s.rle {
+		case 2:
+			px, err = s.Rle8Decode(s.compressed[4:])
+		case 3:
+			px = s.Rle5Decode(s.compressed[4:])
+		case 4:
+			px, err = s.Lz5Decode(s.compressed[4:])
+		}
+	case -s.rle >= 10 && -s.rle <= 12:
+		data, err := embeddedPNG(s.compressed)
+		if err != nil {
+			return nil, fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+		}
+		if p, ok := img.(*image.Paletted); ok && -s.rle == 10 {
+			p.Palette = genPalette(s.Pal)
+		}
+		return img, nil
+	default:
+		return nil, fmt.Errorf("Sprite %v,%v: unsupported format %v", s.Group, s.Number, formatName(-s.rle))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+	}
+	img := image.NewPaletted(image.Rect(0, 0, int(s.Size[0]), int(s.Size[1])), genPalette(s.Pal))
+	copy(img.Pix, px)
+	return img, nil
 }
 
 func newSprite() *Sprite {
@@ -246,6 +414,7 @@ func (s *Sprite) shareCopy(src *Sprite) {
 		s.palidx = src.palidx
 	}
 	s.coldepth = src.coldepth
+	s.planes = src.planes
 	//s.paltemp = src.paltemp
 	//s.PalTex = src.PalTex
 }
@@ -256,6 +425,14 @@ func (s *Sprite) GetPal(pl *PaletteList) []uint32 {
 	return pl.Get(int(s.palidx)) //pl.palettes[pl.paletteMap[int(s.palidx)]]
 }
 
+// outputPal returns the palette used to save the sprite, -apply-pal replaces the sprite's own palette
+func (s *Sprite) outputPal(pl *PaletteList) []uint32 {
+	if optApplyPal != nil {
+		return optApplyPal
+	}
+	return pl.Get(s.palidx)
+}
+
 func (s *Sprite) GetPalTex(pl *PaletteList) Texture {
 	if s.coldepth > 8 {
 		return nil
@@ -288,7 +465,7 @@ func (s *Sprite) readHeader(r io.Reader, ofs, size *uint32, link *uint16) error
 	return nil
 }
 
-func (s *Sprite) readPcxHeader(f *physfs.File, offset int64) error {
+func (s *Sprite) readPcxHeader(f io.ReadSeeker, offset int64) error {
 	f.Seek(offset, 0)
 	read := func(x interface{}) error {
 		return binary.Read(f, binary.LittleEndian, x)
@@ -305,19 +482,40 @@ func (s *Sprite) readPcxHeader(f *physfs.File, offset int64) error {
 		return err
 	}
 	if bpp != 8 {
-		return fmt.Errorf(fmt.Sprintf("Invalid PCX color depth: expected 8-bit, got %v", bpp))
+		return fmt.Errorf("%w: PCX with %v bits per pixel", errUnsupportedFormat, bpp)
 	}
 	var rect [4]uint16
 	if err := read(rect[:]); err != nil {
 		return err
 	}
-	f.Seek(offset+66, 0)
+	f.Seek(offset+65, 0)
+	var planes byte
+	if err := read(&planes); err != nil {
+		return err
+	}
+	if planes != 3 && planes > 1 {
+		return fmt.Errorf("%w: PCX with %v color planes", errUnsupportedFormat, planes)
+	}
 	var bpl uint16
 	if err := read(&bpl); err != nil {
 		return err
 	}
-	s.Size[0] = rect[2] - rect[0] + 1
-	s.Size[1] = rect[3] - rect[1] + 1
+	if rect[2] < rect[0] || rect[3] < rect[1] {
+		return fmt.Errorf("Invalid PCX rect: (%v,%v)-(%v,%v)", rect[0], rect[1], rect[2], rect[3])
+	}
+	w, h := int(rect[2])-int(rect[0])+1, int(rect[3])-int(rect[1])+1
+	if w > optMaxDim || h > optMaxDim {
+		return fmt.Errorf("Invalid PCX size: %vx%v exceeds %v (see -max-dim)", w, h, optMaxDim)
+	}
+	if encoding == 1 && int(bpl) < w {
+		return fmt.Errorf("Invalid PCX bytes per line: %v for width %v", bpl, w)
+	}
+	s.Size[0] = uint16(w)
+	s.Size[1] = uint16(h)
+	s.planes = max(planes, 1)
+	if planes == 3 {
+		s.coldepth = 24
+	}
 	if encoding == 1 {
 		s.rle = int(bpl)
 	} else {
@@ -325,13 +523,35 @@ func (s *Sprite) readPcxHeader(f *physfs.File, offset int64) error {
 	}
 	return nil
 }
-func (s *Sprite) RlePcxDecode(rle []byte) (p []byte) {
+
+// checkPixels returns an error if the sprite is larger than -max-pixels.
+// It is called before decoding since the decoders allocate width*height bytes read from the untrusted header.
+func (s *Sprite) checkPixels() error {
+	if n := int(s.Size[0]) * int(s.Size[1]); optMaxPixels > 0 && n > optMaxPixels {
+		return fmt.Errorf("%vx%v exceeds %v pixels (see -max-pixels)", s.Size[0], s.Size[1], optMaxPixels)
+	}
+	return nil
+}
+
+// RlePcxDecode decodes PCX RLE sprite data. Once the data is used up its last byte is repeated,
+// a zero-length run there would never fill the sprite and is an error.
+func (s *Sprite) RlePcxDecode(rle []byte) (p []byte, err error) {
 	if len(rle) == 0 || s.rle <= 0 {
-		return rle
+		return rle, nil
 	}
-	p = make([]byte, int(s.Size[0])*int(s.Size[1]))
-	i, j, k, w := 0, 0, 0, int(s.Size[0])
+	if p, err = rlePcxLines(rle, int(s.Size[0]), int(s.Size[1]), s.rle); err != nil {
+		return nil, err
+	}
+	s.rle = 0
+	return
+}
+
+// rlePcxLines decodes h lines of bpl bytes of PCX RLE data and keeps the first w bytes of every line
+func rlePcxLines(rle []byte, w, h, bpl int) ([]byte, error) {
+	p := make([]byte, w*h)
+	i, j, k := 0, 0, 0
 	for j < len(p) {
+		i0, j0, k0 := i, j, k
 		n, d := 1, rle[i]
 		if i < len(rle)-1 {
 			i++
@@ -349,20 +569,65 @@ func (s *Sprite) RlePcxDecode(rle []byte) (p []byte) {
 				j++
 			}
 			k++
-			if k == s.rle {
+			if k == bpl {
 				k = 0
 				n = 1
 			}
 		}
+		if i == i0 && j == j0 && k == k0 {
+			return nil, fmt.Errorf("PCX data ends after %v of %v pixels", j, len(p))
+		}
 	}
-	s.rle = 0
-	return
+	return p, nil
+}
+
+// pcx24Image decodes a 24-bit PCX sprite, whose lines hold the red, green and blue bytes of the row
+// one after the other, bytes per line each. 24-bit PCX has no transparency, the image is opaque.
+func (s *Sprite) pcx24Image(px []byte) (*image.NRGBA, error) {
+	w, h := int(s.Size[0]), int(s.Size[1])
+	bpl := max(s.rle, w)
+	if s.rle > 0 {
+		var err error
+		if px, err = rlePcxLines(px, 3*bpl, h, 3*bpl); err != nil {
+			return nil, err
+		}
+	} else if len(px) < 3*bpl*h {
+		return nil, fmt.Errorf("PCX data ends after %v of %v bytes", len(px), 3*bpl*h)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		line := px[3*bpl*y:]
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{line[x], line[bpl+x], line[2*bpl+x], 255})
+		}
+	}
+	return img, nil
+}
+
+// pcxPaletteOffset returns the file offset of the 768-byte palette at the end of a v1 PCX sprite.
+// A PCX palette follows a 0x0C marker byte. The size derived from the next subheader includes any
+// padding between sprites, so when the marker is not found there, the size stored in the subheader is tried.
+// It also reports whether the marker was found.
+func pcxPaletteOffset(f io.ReadSeeker, offset int64, sizes ...uint32) (int64, bool) {
+	for _, size := range sizes {
+		if size < 128+769 {
+			continue
+		}
+		var marker [1]byte
+		f.Seek(offset+int64(size)-769, 0)
+		if _, err := io.ReadFull(f, marker[:]); err == nil && marker[0] == 0x0c {
+			return offset + int64(size) - 768, true
+		}
+	}
+	return offset + int64(sizes[0]) - 768, false
 }
-func (s *Sprite) read(f *physfs.File, sff *Sff, offset int64, datasize uint32,
+
+func (s *Sprite) read(f io.ReadSeeker, sff *Sff, offset int64, datasize uint32,
 	nextSubheader uint32, prev *Sprite, pl *PaletteList, c00 bool) error {
+	headerSize := datasize
 	if int64(nextSubheader) > offset {
 		// Ignore datasize except last
-		datasize = nextSubheader - uint32(offset)
+		datasize = uint32(int64(nextSubheader) - offset)
 	}
 	read := func(x interface{}) error {
 		return binary.Read(f, binary.LittleEndian, x)
@@ -372,12 +637,24 @@ func (s *Sprite) read(f *physfs.File, sff *Sff, offset int64, datasize uint32,
 		return err
 	}
 	paletteSame := ps != 0 && prev != nil
-	if err := s.readPcxHeader(f, offset); err != nil {
-		return err
+	headerErr := s.readPcxHeader(f, offset)
+	if headerErr != nil && !errors.Is(headerErr, errUnsupportedFormat) {
+		return headerErr
+	}
+	// Only 8-bit PCX ends with a palette, the other sprites pass on the palette of the previous one
+	noPal := headerErr != nil || s.planes == 3
+	palOffset, hasPal := pcxPaletteOffset(f, offset, datasize, headerSize)
+	if paletteSame && !noPal && hasPal {
+		// Some files store a palette at the end of every sprite, whatever its same palette flag says
+		if optV1PalAtEnd {
+			paletteSame = false
+		} else {
+			sff.numPalAtEnd++
+		}
 	}
 	f.Seek(offset+128, 0)
 	var palSize uint32
-	if c00 || paletteSame {
+	if c00 || paletteSame || noPal {
 		palSize = 0
 	} else {
 		palSize = 768
@@ -389,8 +666,10 @@ func (s *Sprite) read(f *physfs.File, sff *Sff, offset int64, datasize uint32,
 	if err := read(px); err != nil {
 		return err
 	}
-	if paletteSame {
-		if prev != nil {
+	if paletteSame || noPal {
+		if sff.sharedPal >= 0 {
+			s.palidx = sff.sharedPal
+		} else if prev != nil {
 			s.palidx = prev.palidx
 		}
 		if s.palidx < 0 {
@@ -399,9 +678,7 @@ func (s *Sprite) read(f *physfs.File, sff *Sff, offset int64, datasize uint32,
 	} else {
 		var pal []uint32
 		s.palidx, pal = pl.NewPal()
-		if c00 {
-			f.Seek(offset+int64(datasize)-768, 0)
-		}
+		f.Seek(palOffset, 0)
 		var rgb [3]byte
 		for i := range pal {
 			if err := read(rgb[:]); err != nil {
@@ -413,26 +690,83 @@ func (s *Sprite) read(f *physfs.File, sff *Sff, offset int64, datasize uint32,
 			}
 			pal[i] = uint32(alpha)<<24 | uint32(rgb[2])<<16 | uint32(rgb[1])<<8 | uint32(rgb[0])
 		}
-		savePalette(pal, fmt.Sprintf("%v %v %v.act", "char_pal", s.Group, s.Number))
+		applyTransparentIndex(pal)
+		if sff.lazy {
+			// keep the palette only
+		} else if optPalCombined != "" {
+			addCombinedPalette(s.Group, s.Number, pal)
+		} else if sff.savePals {
+			prefix := "char_pal"
+			if optFlattenDir != "" {
+				prefix = filepath.Base(sff.outbase) + " char_pal"
+			}
+			actFilename := filepath.Join(filepath.Dir(sff.outbase), fmt.Sprintf("%v %v %v%v.act", prefix, groupNo(s.Group), groupNo(s.Number), dupSuffix(s)))
+			sff.savePalette(pal, actFilename)
+			if optPalSwatch {
+				if err := savePaletteSwatch(pal, actFilename); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
 	}
+	// -keep-pcx writes the palette of the sprite, not the one of -uniform-pal
+	ownPal := s.palidx
+	if optUniformPal {
+		// The first palette of the file, or -shared-pal, is the character palette
+		if sff.uniformPal < 0 {
+			sff.uniformPal = s.palidx
+		}
+		s.palidx = sff.uniformPal
+	}
+	if headerErr != nil {
+		return headerErr
+	}
+	if sff.lazy {
+		s.compressed = px
+		return nil
+	}
+	if sff.skipImage || !spriteSelected(s) {
+		return nil
+	}
+	if err := s.checkPixels(); err != nil {
+		return err
+	}
+	defer memBudget.release(memBudget.acquire(s.decodedSize()))
 
-	// Create a new Paletted image
-	img := image.NewPaletted(image.Rect(0, 0, int(s.Size[0]), int(s.Size[1])), genPalette(pl.Get(s.palidx)))
-	img.Pix = s.RlePcxDecode(px)
-
-	// Extract filename without extension
-	baseFilename := strings.TrimSuffix(sff.filename, filepath.Ext(sff.filename))
-	pngFilename := fmt.Sprintf("%v %v %v.png", s.Group, s.Number, baseFilename)
-	// fmt.Printf("Saving %v with Palette id=%v\n", pngFilename, s.palidx)
+	if optKeepPCX {
+		// A PCX storing its palette is written as is, the others get the palette they are drawn with
+		size, pal := 128+int64(len(px)), []uint32(nil)
+		if hasPal {
+			size = palOffset + 768 - offset
+		} else if !noPal {
+			pal = pl.Get(ownPal)
+		}
+		if err := savePCX(f, offset, size, sff, s, pal); err != nil {
+			return err
+		}
+	}
 
-	// Save the image to a file
-	fo, err := os.Create(pngFilename)
+	start := time.Now()
+	if s.planes == 3 {
+		img, err := s.pcx24Image(px)
+		if err != nil {
+			return err
+		}
+		sff.decodeTime = timeSince(start)
+		// Saved like an SFF v2 PNG24 sprite, so every option working on true-color sprites applies
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		s.rle = -11
+		return saveImageToPNG3(sff, s, buf.Bytes())
+	}
+	px, err := s.RlePcxDecode(px)
 	if err != nil {
-		return fmt.Errorf("Error creating file %v: %v", pngFilename, err)
+		return err
 	}
-	defer fo.Close()
-
-	return png.Encode(fo, img)
+	sff.decodeTime = timeSince(start)
+	return saveImageToPNG(sff, s, px)
 }
 
 func (s *Sprite) readHeaderV2(r io.Reader, ofs *uint32, size *uint32,
@@ -477,20 +811,26 @@ func (s *Sprite) readHeaderV2(r io.Reader, ofs *uint32, size *uint32,
 	if err := read(&tmp); err != nil {
 		return err
 	}
-	if tmp&1 == 0 {
-		*ofs += lofs
-	} else {
-		*ofs += tofs
+	base := lofs
+	if tmp&1 != 0 {
+		base = tofs
 	}
+	if uint64(*ofs)+uint64(base) > 0xffffffff {
+		return fmt.Errorf("sprite data offset %v+%v is beyond 4GB", base, *ofs)
+	}
+	*ofs += base
 	return nil
 }
-func (s *Sprite) Rle8Decode(rle []byte) (p []byte) {
+
+// Rle8Decode decodes RLE8 sprite data, like RlePcxDecode a zero-length run at the end of the data is an error
+func (s *Sprite) Rle8Decode(rle []byte) (p []byte, err error) {
 	if len(rle) == 0 {
-		return rle
+		return rle, nil
 	}
 	p = make([]byte, int(s.Size[0])*int(s.Size[1]))
 	i, j := 0, 0
 	for j < len(p) {
+		i0, j0 := i, j
 		n, d := 1, rle[i]
 		if i < len(rle)-1 {
 			i++
@@ -508,6 +848,9 @@ func (s *Sprite) Rle8Decode(rle []byte) (p []byte) {
 				j++
 			}
 		}
+		if i == i0 && j == j0 {
+			return nil, fmt.Errorf("RLE8 data ends after %v of %v pixels", j, len(p))
+		}
 	}
 	return
 }
@@ -554,9 +897,12 @@ func (s *Sprite) Rle5Decode(rle []byte) (p []byte) {
 	}
 	return
 }
-func (s *Sprite) Lz5Decode(rle []byte) (p []byte) {
+
+// Lz5Decode decodes LZ5 sprite data. Every control bit writes at least one pixel, so decoding ends
+// even when the stream is too short, a back-reference before the first pixel is an error.
+func (s *Sprite) Lz5Decode(rle []byte) (p []byte, err error) {
 	if len(rle) == 0 {
-		return rle
+		return rle, nil
 	}
 	p = make([]byte, int(s.Size[0])*int(s.Size[1]))
 	i, j, n := 0, 0, 0
@@ -593,6 +939,9 @@ func (s *Sprite) Lz5Decode(rle []byte) (p []byte) {
 					rb, rbc = 0, 0
 				}
 			}
+			if d > j {
+				return nil, fmt.Errorf("LZ5 back-reference %v pixels before pixel %v", d, j)
+			}
 			for {
 				if j < len(p) {
 					p[j] = p[j-d]
@@ -631,35 +980,417 @@ func (s *Sprite) Lz5Decode(rle []byte) (p []byte) {
 	return
 }
 
+// trim crops img to the bounding box of its non transparent pixels and moves the sprite axis accordingly.
+// A fully transparent sprite becomes a 1x1 image.
+func (s *Sprite) trim(img *image.Paletted) *image.Paletted {
+	key := uint8(optTransparentIndex)
+	b := img.Bounds()
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X-1, b.Min.Y-1
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.Pix[img.PixOffset(x, y)] == key {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+	}
+	if maxX < minX {
+		out := image.NewPaletted(image.Rect(0, 0, 1, 1), img.Palette)
+		out.Pix[0] = key
+		s.Size = [2]uint16{1, 1}
+		return out
+	}
+	out := image.NewPaletted(image.Rect(0, 0, maxX-minX+1, maxY-minY+1), img.Palette)
+	for y := minY; y <= maxY; y++ {
+		copy(out.Pix[out.PixOffset(0, y-minY):], img.Pix[img.PixOffset(minX, y):img.PixOffset(maxX+1, y)])
+	}
+	s.Offset[0] -= int16(minX - b.Min.X)
+	s.Offset[1] -= int16(minY - b.Min.Y)
+	s.Size = [2]uint16{uint16(maxX - minX + 1), uint16(maxY - minY + 1)}
+	return out
+}
+
+// scale enlarges img by -scale with nearest neighbor, paletted images keep their indices and palette.
+// The sprite size and offset are scaled too so the axis stays on the same pixel, a sprite whose
+// scaled size or offset does not fit in the sff fields is an error.
+func (s *Sprite) scale(img image.Image) (image.Image, error) {
+	n := optScale
+	b := img.Bounds()
+	r := image.Rect(0, 0, b.Dx()*n, b.Dy()*n)
+	for _, v := range s.Offset {
+		if v := int(v) * n; v < math.MinInt16 || v > math.MaxInt16 {
+			return nil, fmt.Errorf("Sprite %v,%v: offset %v,%v scaled by %v is out of range", s.Group, s.Number, s.Offset[0], s.Offset[1], n)
+		}
+	}
+	if r.Dx() > math.MaxUint16 || r.Dy() > math.MaxUint16 {
+		return nil, fmt.Errorf("Sprite %v,%v: %vx%v scaled by %v exceeds %v pixels", s.Group, s.Number, b.Dx(), b.Dy(), n, math.MaxUint16)
+	}
+	s.Size = [2]uint16{uint16(r.Dx()), uint16(r.Dy())}
+	s.Offset = [2]int16{s.Offset[0] * int16(n), s.Offset[1] * int16(n)}
+	if p, ok := img.(*image.Paletted); ok {
+		out := image.NewPaletted(r, p.Palette)
+		for y := 0; y < r.Dy(); y++ {
+			src := p.Pix[p.PixOffset(b.Min.X, b.Min.Y+y/n):]
+			row := out.Pix[out.PixOffset(0, y):out.PixOffset(r.Dx(), y)]
+			for x := range row {
+				row[x] = src[x/n]
+			}
+		}
+		return out, nil
+	}
+	out := image.NewNRGBA(r)
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			out.Set(x, y, img.At(b.Min.X+x/n, b.Min.Y+y/n))
+		}
+	}
+	return out, nil
+}
+
+// flip mirrors img for -flip, paletted images keep their indices and palette.
+// The offset is mirrored too so the axis stays on the same pixel of the sprite.
+func (s *Sprite) flip(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	fh, fv := optFlip != "v", optFlip != "h"
+	src := func(x, y int) (int, int) {
+		if fh {
+			x = w - 1 - x
+		}
+		if fv {
+			y = h - 1 - y
+		}
+		return b.Min.X + x, b.Min.Y + y
+	}
+	if fh {
+		s.Offset[0] = int16(w) - s.Offset[0]
+	}
+	if fv {
+		s.Offset[1] = int16(h) - s.Offset[1]
+	}
+	r := image.Rect(0, 0, w, h)
+	if p, ok := img.(*image.Paletted); ok {
+		out := image.NewPaletted(r, p.Palette)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				out.Pix[out.PixOffset(x, y)] = p.Pix[p.PixOffset(src(x, y))]
+			}
+		}
+		return out
+	}
+	out := image.NewNRGBA(r)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(src(x, y)))
+		}
+	}
+	return out
+}
+
+// needDecodedImage reports whether any option consumes the decoded image of a sprite
+func needDecodedImage() bool {
+	return optContactSheet != "" || hashWriter != nil || optSingle != "" || optThumbs > 0 || OnSprite != nil || optBestFormat
+}
+
+// onSpriteDecoded is called with the final image of every saved sprite
+func onSpriteDecoded(sff *Sff, s *Sprite, img image.Image) {
+	if optContactSheet != "" {
+		addToContactSheet(s, img)
+	}
+	if hashWriter != nil {
+		writeSpriteHash(s, img)
+	}
+	if optSingle != "" {
+		singlePages = append(singlePages, img)
+	}
+	if optBestFormat {
+		writeBestFormat(sff, s, img)
+	}
+}
+
+// groupNo formats a sprite or palette group/number for output.
+// Values above 32767 are stored as negative int16, -unsigned-groups prints them as uint16.
+func groupNo(v int16) string {
+	return strconv.Itoa(groupValue(v))
+}
+
+// groupValue returns a group or sprite number as it is printed by groupNo, to sort them
+func groupValue(v int16) int {
+	if optUnsignedGroups {
+		return int(uint16(v))
+	}
+	return int(v)
+}
+
+// actionSuffix returns the name of the sprite given by -names, or else its action name loaded via -def,
+// to append to output filenames
+func actionSuffix(s *Sprite) string {
+	if name, ok := spriteNames[[...]int16{s.Group, s.Number}]; ok {
+		return " " + name
+	}
+	if name, ok := groupNames[s.Group]; ok {
+		return " " + name
+	}
+	if name, ok := actionNames[[...]int16{s.Group, s.Number}]; ok {
+		return " " + name
+	}
+	return ""
+}
+
+// dupSuffix returns the file index of a sprite whose group,number is already used by an earlier sprite,
+// so its output file does not overwrite the earlier one
+func dupSuffix(s *Sprite) string {
+	if s.dup {
+		return fmt.Sprintf(" #%v", s.index)
+	}
+	return ""
+}
+
+// applyTransparentIndex moves the color key from index 0 to the index given by -transparent-index
+func applyTransparentIndex(pal []uint32) {
+	if optTransparentIndex == 0 || optTransparentIndex >= len(pal) {
+		return
+	}
+	pal[0] |= 0xff000000
+	pal[optTransparentIndex] &= 0x00ffffff
+}
+
+// normalizePalette returns pal with exactly 256 entries. Missing entries are filled with
+// transparent black, the value of the colors an SFF v2 palette with fewer than 256 colors does not store,
+// so every index of an 8-bit sprite has a defined color. Extra entries are dropped.
+func normalizePalette(pal []uint32) []uint32 {
+	if len(pal) == 256 {
+		return pal
+	}
+	out := make([]uint32, 256)
+	copy(out, pal)
+	return out
+}
+
+// genPalette converts an sff palette to straight alpha colors, so translucent SFF v2.01 entries
+// keep their RGB in the PLTE chunk and their alpha in tRNS. The palette always has 256 colors,
+// see normalizePalette.
 func genPalette(pal []uint32) color.Palette {
+	pal = normalizePalette(pal)
 	palette := make(color.Palette, len(pal))
 	for i, c := range pal {
-		palette[i] = color.RGBA{uint8(c), uint8(c >> 8), uint8(c >> 16), uint8(c >> 24)}
+		alpha := uint8(c >> 24)
+		if optTRNS {
+			// Only the transparent index has alpha
+			alpha = 255
+			if i == optTransparentIndex {
+				alpha = 0
+			}
+		}
+		palette[i] = color.NRGBA{uint8(c), uint8(c >> 8), uint8(c >> 16), alpha}
 	}
 	return palette
 }
 
-// save palette to file
+// skipWrite reports whether filename must not be written. With -dry-run the planned file and its
+// estimated size are logged instead, with -no-overwrite an existing file is kept.
+func skipWrite(filename string, size int) bool {
+	if optDryRun {
+		fmt.Printf("Would write %v (%v bytes)\n", filename, size)
+		dryRunFiles++
+		dryRunBytes += int64(size)
+		return true
+	}
+	if !optNoOverwrite {
+		return false
+	}
+	if !outputExists(filename) {
+		return false
+	}
+	fmt.Printf("Skip existing %v\n", filename)
+	return true
+}
+
+// save palette to file. A palette of less than 256 colors is padded with black
+// and followed by the Adobe color count and transparent index.
 func savePalette(pal []uint32, filename string) error {
-	fo, err := os.Create(filename)
-	defer fo.Close()
+	_, err := writePalette(pal, filename)
+	return err
+}
+
+// savePalette writes an ACT file of the sff and counts it in the summary
+func (sff *Sff) savePalette(pal []uint32, filename string) {
+	write := writePalette
+	if optPalFormat == "png" {
+		write, filename = writePalettePNG, strings.TrimSuffix(filename, ".act")+".pal.png"
+	}
+	if n, err := write(pal, filename); err != nil {
+		fmt.Println(err)
+	} else if n > 0 {
+		sff.numPals++
+		sff.savedBytes += n
+	}
+}
+
+// writePalette writes pal to the ACT file filename and returns its size, 0 when the file is skipped
+func writePalette(pal []uint32, filename string) (int64, error) {
+	size := 768
+	if len(pal) < 256 {
+		size += 4
+	}
+	if skipWrite(filename, size) {
+		return 0, nil
+	}
+	fo, err := createOutput(filename)
 	if err != nil {
-		return fmt.Errorf("Error creating file %v:  %v\n", filename, err)
+		return 0, fmt.Errorf("Error creating file %v:  %v\n", filename, err)
 	} else {
+		defer fo.Close()
 		for _, c := range pal {
 			_, err = fo.Write([]byte{uint8(c), uint8(c >> 8), uint8(c >> 16)}) // Write as byte
 			if err != nil {
-				return fmt.Errorf("Error writing to file: %v\n", err)
+				return 0, fmt.Errorf("Error writing to file: %v\n", err)
 			}
 		}
-		return nil
+		if len(pal) < 256 {
+			footer := make([]byte, (256-len(pal))*3, (256-len(pal))*3+4)
+			footer = binary.BigEndian.AppendUint16(footer, uint16(len(pal)))
+			footer = binary.BigEndian.AppendUint16(footer, 0) // index 0 is transparent
+			if _, err = fo.Write(footer); err != nil {
+				return 0, fmt.Errorf("Error writing to file: %v\n", err)
+			}
+		}
+		return int64(max(size, 3*len(pal))), nil
+	}
+}
+
+// load palette from ACT file (256 RGB entries), index 0 is transparent.
+// Mugen character ACT files store the colors in reverse order.
+func loadPalette(filename string, reversed bool) ([]uint32, error) {
+	data, err := physfs.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading palette %v: %v", filename, err)
+	}
+	if len(data) < 768 {
+		return nil, fmt.Errorf("Invalid ACT file %v: expected 768 bytes, got %v", filename, len(data))
+	}
+	pal := make([]uint32, 256)
+	for i := range pal {
+		var alpha uint32 = 255
+		if i == 0 {
+			alpha = 0
+		}
+		j := i
+		if reversed {
+			j = 255 - i
+		}
+		pal[i] = alpha<<24 | uint32(data[j*3+2])<<16 | uint32(data[j*3+1])<<8 | uint32(data[j*3])
+	}
+	applyTransparentIndex(pal)
+	return pal, nil
+}
+
+type paletteRemap struct {
+	src int
+	dst string // palette index or ACT filename
+}
+
+// parseRemap parses "src:dst,..." where dst is a palette index or an ACT file
+func parseRemap(arg string) ([]paletteRemap, error) {
+	var remaps []paletteRemap
+	for _, item := range strings.Split(arg, ",") {
+		src, dst, found := strings.Cut(item, ":")
+		n, err := strconv.Atoi(src)
+		if !found || err != nil || n < 0 || dst == "" {
+			return nil, fmt.Errorf("Invalid remap %q, expected src:dst", item)
+		}
+		remaps = append(remaps, paletteRemap{n, dst})
+	}
+	return remaps, nil
+}
+
+// applyRemap redirects palettes given by -remap so sprites are rendered with an alternate palette
+func applyRemap(pl *PaletteList, remaps []paletteRemap) error {
+	for _, r := range remaps {
+		if r.src >= len(pl.paletteMap) {
+			return fmt.Errorf("Invalid remap source palette %v (%v palettes)", r.src, len(pl.paletteMap))
+		}
+		dst, err := strconv.Atoi(r.dst)
+		if err != nil {
+			pal, err := loadPalette(r.dst, false)
+			if err != nil {
+				return err
+			}
+			dst, _ = pl.NewPal()
+			pl.SetSource(dst, pal)
+		} else if dst < 0 || dst >= len(pl.palettes) {
+			return fmt.Errorf("Invalid remap destination palette %v (%v palettes)", dst, len(pl.palettes))
+		}
+		pl.Remap(r.src, dst)
+	}
+	return nil
+}
+
+var pngSignature = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+// embeddedPNG returns the PNG stream stored in the data of a format 10-12 sprite.
+// The PNG normally follows a 4-byte uncompressed size, otherwise its signature is searched for.
+// The stream is cut after the IEND chunk.
+func embeddedPNG(data []byte) ([]byte, error) {
+	start := 4
+	if len(data) < start+len(pngSignature) || !bytes.Equal(data[start:start+len(pngSignature)], pngSignature) {
+		start = bytes.Index(data, pngSignature)
+		if start < 0 {
+			return nil, fmt.Errorf("PNG signature not found")
+		}
+		fmt.Printf("PNG signature found at offset %v instead of 4\n", start)
+	}
+	data = data[start:]
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		pos += 12 + length
+		if chunkType == "IEND" {
+			return data[:pos], nil
+		}
+	}
+	return data, nil
+}
+
+// paletteAlpha returns the tRNS entries of palette, up to the last one that is not opaque
+func paletteAlpha(palette []uint32) []byte {
+	if optTRNS {
+		if optTransparentIndex >= len(palette) {
+			return nil
+		}
+		alpha := bytes.Repeat([]byte{255}, optTransparentIndex+1)
+		alpha[optTransparentIndex] = 0
+		return alpha
+	}
+	alpha := make([]byte, len(palette))
+	n := 0
+	for i, c := range palette {
+		if alpha[i] = uint8(c >> 24); alpha[i] != 255 {
+			n = i + 1
+		}
 	}
+	return alpha[:n]
 }
 
 func replacePaletteInMemory(imgBuffer *bytes.Buffer, palette []uint32) error {
 	// Read PNG signature (8 bytes)
 	signature := make([]byte, 8)
-	if _, err := imgBuffer.Read(signature); err != nil || !bytes.Equal(signature, []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}) {
+	if _, err := imgBuffer.Read(signature); err != nil || !bytes.Equal(signature, pngSignature) {
 		return fmt.Errorf("not a valid PNG file")
 	}
 
@@ -668,6 +1399,7 @@ func replacePaletteInMemory(imgBuffer *bytes.Buffer, palette []uint32) error {
 	outputBuffer.Write(signature) // Write PNG signature
 
 	// Process PNG chunks
+	maxColors := 256
 	for {
 		// Read chunk length (4 bytes)
 		lengthBytes := make([]byte, 4)
@@ -690,10 +1422,21 @@ func replacePaletteInMemory(imgBuffer *bytes.Buffer, palette []uint32) error {
 			return fmt.Errorf("error reading chunk data: %w", err)
 		}
 
+		if string(chunkType) == "IHDR" && length >= 9 {
+			// A PLTE must not hold more entries than the bit depth of the pixels can index
+			maxColors = 1 << min(chunkData[8], 8)
+		}
+
 		// If it's the PLTE chunk, replace it
 		if string(chunkType) == "PLTE" {
 			// fmt.Println("Replacing PLTE chunk with in-memory palette...")
 
+			// Keep at least the entries of the original PLTE, the pixels and tRNS may refer to them
+			if n := int(length / 3); n > len(palette) && n <= cap(palette) {
+				palette = palette[:n]
+			}
+			palette = palette[:min(len(palette), maxColors)]
+
 			// Convert palette to byte slice
 			actPalette := make([]byte, 0, 768)
 			for _, c := range palette {
@@ -716,6 +1459,16 @@ func replacePaletteInMemory(imgBuffer *bytes.Buffer, palette []uint32) error {
 
 			// Write new CRC
 			binary.Write(&outputBuffer, binary.BigEndian, newCRC)
+
+			// The alpha of the palette replaces the original tRNS chunk, -trns only marks the transparent index
+			if alpha := paletteAlpha(palette); len(alpha) > 0 {
+				binary.Write(&outputBuffer, binary.BigEndian, uint32(len(alpha)))
+				outputBuffer.WriteString("tRNS")
+				outputBuffer.Write(alpha)
+				binary.Write(&outputBuffer, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("tRNS"), alpha...)))
+			}
+		} else if string(chunkType) == "tRNS" {
+			// Dropped, written after PLTE
 		} else {
 			// Write the original chunk unchanged
 			outputBuffer.Write(lengthBytes)
@@ -731,99 +1484,341 @@ func replacePaletteInMemory(imgBuffer *bytes.Buffer, palette []uint32) error {
 	return nil
 }
 
-func saveImageToPNG(sff *Sff, s *Sprite, data []byte) error {
-	rect := image.Rect(0, 0, int(s.Size[0]), int(s.Size[1]))
-
-	// Create a new Paletted image
-	img := image.NewPaletted(rect, genPalette(sff.palList.Get(s.palidx)))
-	img.Pix = data
-
-	// Extract filename without extension
-	baseFilename := sff.filename[:len(sff.filename)-4]
-	pngFilename := fmt.Sprintf("%v %v %v.png", baseFilename, s.Group, s.Number)
-	tsvFilename := fmt.Sprintf("%v.tsv", baseFilename)
-	// fmt.Printf("Saving %v with Palette id=%v\n", pngFilename, s.palidx)
+// numColors returns the number of palette colors saved for sprite s, 0 for true-color sprites
+func (sff *Sff) numColors(s *Sprite) int {
+	return s.numColors(&sff.palList)
+}
 
-	// Create or Open the TSV file
-	tsvFile, err := os.OpenFile(tsvFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("Error creating file %v: %v", tsvFilename, err)
+// numColors is Sff.numColors with the palettes of pl
+func (s *Sprite) numColors(pl *PaletteList) int {
+	if optApplyPal != nil {
+		return len(optApplyPal)
+	}
+	if s.coldepth > 8 {
+		return 0
+	}
+	return pl.NumColors(s.palidx)
+}
+
+// appendTsv records the sprite info in the TSV file, link is the sprite s is linked to (-skip-linked) or nil.
+// colors is the number of palette colors of the sprite.
+func appendTsv(tsvFilename string, s *Sprite, link *Sprite, colors int) error {
+	if optDryRun {
+		return nil
+	}
+	var tsvFile io.StringWriter
+	if zipOutput != nil {
+		// zip entries cannot be appended to, the rows are kept until the archive is closed
+		name := zipName(tsvFilename)
+		if zipTsv[name] == nil {
+			zipTsv[name] = new(bytes.Buffer)
+		}
+		tsvFile = zipTsv[name]
+	} else {
+		// Create or Open the TSV file
+		f, err := os.OpenFile(tsvFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("Error creating file %v: %v", tsvFilename, err)
+		}
+		defer f.Close()
+		tsvFile = f
+	}
+	linkTo := ""
+	if link != nil {
+		linkTo = fmt.Sprintf("%v,%v", groupNo(link.Group), groupNo(link.Number))
+	}
+	_, err := tsvFile.WriteString(fmt.Sprintf("%v,%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", groupNo(s.Group), groupNo(s.Number), s.Size[0], s.Size[1], s.palidx, s.rle, s.coldepth, s.Offset[0], s.Offset[1], linkTo, colors))
+	return err
+}
+
+// spriteFilename returns the output image filename of sprite s, "<name> <group> <number>" for SFF v1 and v2,
+// or "<name>/<group>/<number>" with -group-dirs
+func (sff *Sff) spriteFilename(s *Sprite) string {
+	if optGroupDirs {
+		return filepath.Join(groupDir(sff.spriteOutbase(s), s.Group), fmt.Sprintf("%v%v.%v", groupNo(s.Number), dupSuffix(s)+actionSuffix(s), optFormat))
+	}
+	return fmt.Sprintf("%v %v %v%v.%v", sff.spriteOutbase(s), groupNo(s.Group), groupNo(s.Number), dupSuffix(s)+actionSuffix(s), optFormat)
+}
+
+// saveLinked writes a linked sprite as its own file with the pixels of src, for -write-linked
+func saveLinked(sff *Sff, s, src *Sprite) error {
+	s.rle = src.rle
+	sff.decodeTime = 0
+	if -src.rle >= 10 {
+		return saveImageToPNG3(sff, s, src.data)
+	}
+	return saveImageToPNG(sff, s, src.data)
+}
+
+func saveImageToPNG(sff *Sff, s *Sprite, data []byte) error {
+	s.data = data
+	img := s.Image(&sff.palList).(*image.Paletted)
+	if !optWriteLinked {
+		s.data = nil // only kept for the sprites linked to s
+	}
+	if optCrop != nil {
+		img = s.crop(img).(*image.Paletted)
+	}
+	if optTrim {
+		img = s.trim(img)
+	}
+	if optScale > 1 {
+		scaled, err := s.scale(img)
+		if err != nil {
+			return err
+		}
+		img = scaled.(*image.Paletted)
+	}
+	if optFlip != "" {
+		img = s.flip(img).(*image.Paletted)
+	}
+	if OnSprite != nil {
+		// The hook changes a copy, the pixels of s are written again for the sprites linked to it
+		img = &image.Paletted{Pix: append([]byte(nil), img.Pix...), Stride: img.Stride, Rect: img.Rect, Palette: img.Palette}
+		if err := OnSprite(s, img); err != nil {
+			return err
+		}
+	}
+	onSpriteDecoded(sff, s, img)
+	if optThumbs > 0 {
+		if err := sff.writeThumbnail(s, img); err != nil {
+			return err
+		}
+	}
+	if offsetsWriter != nil {
+		writeSpriteOffsets(s)
+	}
+
+	// Extract filename without extension
+	baseFilename := sff.spriteOutbase(s)
+	pngFilename := sff.spriteFilename(s)
+	tsvFilename := fmt.Sprintf("%v.tsv", baseFilename)
+	// fmt.Printf("Saving %v with Palette id=%v\n", pngFilename, s.palidx)
+
+	if sff.header.Ver0 != 1 {
+		if err := appendTsv(tsvFilename, s, nil, sff.numColors(s)); err != nil {
+			return err
+		}
 	}
-	tsvFile.WriteString(fmt.Sprintf("%v,%v\t%v\t%v\t%v\t%v\t%v\n", s.Group, s.Number, s.Size[0], s.Size[1], s.palidx, s.rle, s.coldepth))
-	tsvFile.Close()
 
 	// Save the image to a file
-	fo, err := os.Create(pngFilename)
+	if optSingle != "" {
+		sff.numSaved++ // page of the multi-page tiff
+		return nil
+	}
+	if skipWrite(pngFilename, int(s.Size[0])*int(s.Size[1])) {
+		return nil
+	}
+	fo, err := createOutput(pngFilename)
 	if err != nil {
 		return fmt.Errorf("Error creating file %v: %v", pngFilename, err)
 	}
 	defer fo.Close()
 
-	return png.Encode(fo, img)
+	start := time.Now()
+	if err := encodeImage(fo, img); err != nil {
+		return err
+	}
+	if timingWriter != nil {
+		writeSpriteTiming(s, sff.decodeTime, time.Since(start))
+	}
+	sff.countSaved(fo)
+	return nil
 }
 
-func saveImageToPNG3(sff *Sff, s *Sprite, fi io.Reader, datasize uint32) error {
+func saveImageToPNG3(sff *Sff, s *Sprite, data []byte) error {
+	if optWriteLinked {
+		s.data = bytes.Clone(data) // data is reused by the palette replacement below
+	}
 	// Extract filename without extension
-	baseFilename := sff.filename[:len(sff.filename)-4]
-	pngFilename := fmt.Sprintf("%v %v %v.png", baseFilename, s.Group, s.Number)
+	baseFilename := sff.spriteOutbase(s)
+	pngFilename := sff.spriteFilename(s)
 	tsvFilename := fmt.Sprintf("%v.tsv", baseFilename)
 
-	// Create or Open the TSV file
-	tsvFile, err := os.OpenFile(tsvFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("Error creating file %v: %v", tsvFilename, err)
-	}
-	tsvFile.WriteString(fmt.Sprintf("%v,%v\t%v\t%v\t%v\t%v\t%v\n", s.Group, s.Number, s.Size[0], s.Size[1], s.palidx, s.rle, s.coldepth))
-	tsvFile.Close()
-
 	// Create an in-memory buffer to store the image data
-	var imgBuffer bytes.Buffer
+	imgBuffer := bytes.NewBuffer(data)
+
+	// Replace the palette in the PNG data with the palette from memory.
+	// Only format 10 (PNG8) has a PLTE chunk, formats 11 (PNG24) and 12 (PNG32) carry their own colors.
+	if -s.rle == 10 {
+		if err := replacePaletteInMemory(imgBuffer, s.outputPal(&sff.palList)[:sff.numColors(s)]); err != nil {
+			return fmt.Errorf("Error replacing palette: %v", err)
+		}
+	}
 
-	// Copy the image data from fi to the in-memory buffer
-	if _, err := io.CopyN(&imgBuffer, fi, int64(datasize-4)); err != nil {
-		return fmt.Errorf("Error copying image data: %v", err)
+	// Formats 11 (PNG24) and 12 (PNG32) are true-color, -quantize and -index-palette turn them into indexed sprites
+	quantize := (optQuantize || optIndexPalette) && -s.rle >= 11
+	var img image.Image
+	if needDecodedImage() || optCrop != nil || optScale > 1 || optFlip != "" || quantize {
+		var err error
+		if img, err = png.Decode(bytes.NewReader(imgBuffer.Bytes())); err != nil {
+			return fmt.Errorf("Error decoding embedded PNG: %v", err)
+		}
+		if quantize && optIndexPalette {
+			img = indexImage(img, s.outputPal(&sff.palList))
+		} else if quantize {
+			var pal []uint32
+			img, pal = quantizeImage(img)
+			if !optNoACT {
+				sff.savePalette(pal, strings.TrimSuffix(pngFilename, "."+optFormat)+".act")
+			}
+		}
+		if optCrop != nil {
+			img = s.crop(img)
+		}
+		if optScale > 1 {
+			if img, err = s.scale(img); err != nil {
+				return err
+			}
+		}
+		if optFlip != "" {
+			img = s.flip(img)
+		}
+		if OnSprite != nil {
+			if err := OnSprite(s, img); err != nil {
+				return err
+			}
+		}
+		onSpriteDecoded(sff, s, img)
+		if optThumbs > 0 {
+			if err := sff.writeThumbnail(s, img); err != nil {
+				return err
+			}
+		}
+	}
+	if offsetsWriter != nil {
+		writeSpriteOffsets(s)
 	}
 
-	// Replace the palette in the PNG data with the palette from memory
-	if err := replacePaletteInMemory(&imgBuffer, sff.palList.Get(s.palidx)); err != nil {
-		return fmt.Errorf("Error replacing palette: %v", err)
+	if sff.header.Ver0 != 1 {
+		if err := appendTsv(tsvFilename, s, nil, sff.numColors(s)); err != nil {
+			return err
+		}
 	}
 
 	// Save the modified PNG data to a file
-	fo, err := os.Create(pngFilename)
+	if optSingle != "" {
+		sff.numSaved++ // page of the multi-page tiff
+		return nil
+	}
+	if skipWrite(pngFilename, len(data)) {
+		return nil
+	}
+	fo, err := createOutput(pngFilename)
 	if err != nil {
 		return fmt.Errorf("Error creating file %v: %v", pngFilename, err)
 	}
 	defer fo.Close()
 
-	if _, err := io.Copy(fo, &imgBuffer); err != nil {
+	start := time.Now()
+	if optFormat != "png" || optCrop != nil || optScale > 1 || optFlip != "" || quantize || optPNG16 || optBackground != nil || OnSprite != nil {
+		if img == nil {
+			if img, err = png.Decode(imgBuffer); err != nil {
+				return fmt.Errorf("Error decoding embedded PNG: %v", err)
+			}
+		}
+		if err := encodeImage(fo, img); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(fo, imgBuffer); err != nil {
 		return fmt.Errorf("Error writing modified PNG: %v", err)
 	}
-
+	if timingWriter != nil {
+		writeSpriteTiming(s, 0, time.Since(start))
+	}
+	sff.countSaved(fo)
 	return nil
 }
 
-func (s *Sprite) readV2(f *physfs.File, offset int64, datasize uint32, sff *Sff) error {
+// countSaved counts the image file fo, as written so far, in the summary
+func (sff *Sff) countSaved(fo *outputFile) {
+	sff.numSaved++
+	sff.savedBytes += fo.size
+}
+
+// encodeImage writes img in the output format selected by -format
+func encodeImage(w io.Writer, img image.Image) error {
+	if optBackground != nil {
+		img = flatten(img, *optBackground)
+	}
+	if optPremultiply {
+		img = premultipliedPixels(premultiply(img))
+	}
+	switch optFormat {
+	case "tga":
+		return encodeTGA(w, img)
+	case "tiff":
+		return encodeTIFF(w, []image.Image{img})
+	default:
+		if optPNG16 {
+			// Sprites carry 8 bits per channel, -png16 only widens them for tools expecting 16-bit PNG
+			img16 := image.NewNRGBA64(img.Bounds())
+			draw.Draw(img16, img16.Bounds(), img, img.Bounds().Min, draw.Src)
+			img = img16
+		}
+		return png.Encode(w, img)
+	}
+}
+
+// errUnsupportedFormat is returned by readV2 and Sprite.read for a sprite they cannot decode, the other sprites can still be read
+var errUnsupportedFormat = errors.New("unsupported sprite")
+
+// readData reads size bytes of sprite data at offset. When the file ends first, a warning is printed and
+// the data is padded with zeros, which RLE8, RLE5 and LZ5 decode as transparent pixels, so the data
+// returned is longer than size. With -strict this is an error instead.
+func (s *Sprite) readData(f io.ReadSeeker, offset int64, size uint32, sff *Sff) ([]byte, error) {
+	data := make([]byte, size)
+	f.Seek(offset, 0)
+	n, err := io.ReadFull(f, data)
+	if err != io.ErrUnexpectedEOF && err != io.EOF {
+		return data, err
+	}
+	if optStrict {
+		return nil, fmt.Errorf("sprite data ends after %v of %v bytes", n, size)
+	}
+	if -s.rle >= 10 {
+		fmt.Printf("Warning: %v sprite %v,%v: data ends after %v of %v bytes, skipped\n", sff.filename, s.Group, s.Number, n, size)
+	} else {
+		fmt.Printf("Warning: %v sprite %v,%v: data ends after %v of %v bytes, padded with transparent pixels\n", sff.filename, s.Group, s.Number, n, size)
+	}
+	pad := int(size) - n + 1
+	if s.checkPixels() == nil {
+		pad += 2 * int(s.Size[0]) * int(s.Size[1]) // RLE5 needs 2 bytes per padding pixel
+	}
+	return append(data[:n], make([]byte, pad)...), nil
+}
+
+func (s *Sprite) readV2(f io.ReadSeeker, offset int64, datasize uint32, sff *Sff) error {
 	var px []byte
-	// var isRaw bool = false
 
 	if s.rle > 0 {
 		return nil
-	} else if s.rle == 0 {
-		f.Seek(offset, 0)
-		px = make([]uint8, datasize)
-		binary.Read(f, binary.LittleEndian, px)
-
-		switch s.coldepth {
-		case 8:
-			// Do nothing, px is already in the expected format
-		case 24, 32:
-			// isRaw = true
-		default:
-			return fmt.Errorf("Unknown color depth")
+	}
+	if err := s.checkPixels(); err != nil {
+		return fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+	}
+	defer memBudget.release(memBudget.acquire(s.decodedSize()))
+	if s.rle == 0 {
+		var err error
+		if px, err = s.readData(f, offset, datasize, sff); err != nil {
+			return err
+		}
+		px = px[:datasize]
+
+		if s.coldepth != 8 {
+			return fmt.Errorf("%w: raw with color depth %v", errUnsupportedFormat, s.coldepth)
+		}
+		// The palette indices as is, a short sprite is padded with transparent pixels
+		if n := int(s.Size[0]) * int(s.Size[1]); len(px) < n {
+			px = append(px, make([]byte, n-len(px))...)
+		} else {
+			px = px[:n]
+		}
+		sff.decodeTime = 0
+		if err := saveImageToPNG(sff, s, px); err != nil {
+			return err
 		}
 	} else {
-		f.Seek(offset+4, 0)
 		format := -s.rle
 
 		var srcPx []byte
@@ -831,22 +1826,33 @@ func (s *Sprite) readV2(f *physfs.File, offset int64, datasize uint32, sff *Sff)
 			if datasize < 4 {
 				datasize = 4
 			}
-			srcPx = make([]byte, datasize-4)
-			if err := binary.Read(f, binary.LittleEndian, srcPx); err != nil {
+			var err error
+			if srcPx, err = s.readData(f, offset+4, datasize-4, sff); err != nil {
 				return err
 			}
+			if optKeepRaw {
+				if err := saveRaw(sff, s, srcPx[:min(int(datasize-4), len(srcPx))]); err != nil {
+					return err
+				}
+			}
 		}
 
 		switch format {
 			case 2, 3, 4:
+				start := time.Now()
+				var err error
 				switch format {
 				case 2:
-					px = s.Rle8Decode(srcPx)
+					px, err = s.Rle8Decode(srcPx)
 				case 3:
 					px = s.Rle5Decode(srcPx)
 				case 4:
-					px = s.Lz5Decode(srcPx)
+					px, err = s.Lz5Decode(srcPx)
+				}
+				if err != nil {
+					return err
 				}
+				sff.decodeTime = timeSince(start)
 				if err := saveImageToPNG(sff, s, px); err != nil {
 					return err
 				}
@@ -856,29 +1862,60 @@ func (s *Sprite) readV2(f *physfs.File, offset int64, datasize uint32, sff *Sff)
 				// defer C.free(unsafe.Pointer(img_tag))
 			case 10, 11, 12:
 				// fmt.Printf("PNG Format %v. Group:%v Num:%v\n", format, s.Group, s.Number)
-				if err := saveImageToPNG3(sff, s, f, datasize); err != nil {
+				data, err := s.readData(f, offset, datasize, sff)
+				if err != nil {
+					return err
+				}
+				if len(data) > int(datasize) {
+					return nil // a cut PNG cannot be decoded
+				}
+				pngData, err := embeddedPNG(data)
+				if err != nil {
+					return fmt.Errorf("Sprite %v,%v: %v", s.Group, s.Number, err)
+				}
+				if err := saveImageToPNG3(sff, s, pngData); err != nil {
 					return err
 				}
 				// C.calculate_image3((*C.FILE)(unsafe.Pointer(f)), C.int(s.Size[0]), C.int(s.Size[1]))
 			default:
-				return fmt.Errorf("Unknown format")
+				return fmt.Errorf("%w: format %v", errUnsupportedFormat, format)
 		}	
 	}
 	return nil
 }
 
 type Sff struct {
-	header   SffHeader
-	sprites  map[[2]int16]*Sprite
-	palList  PaletteList
-	filename string
+	header     SffHeader
+	sprites    map[[2]int16][]*Sprite // every sprite with a group,number, in file order
+	spriteList []*Sprite              // all sprites in file order
+	palList    PaletteList
+	filename   string
+	outbase    string // output path without extension, below -o when given
+
+	sharedPal int  // v1: palette index of -shared-pal used by sprites with the same palette flag
+	numSaved  int  // number of sprite image files written
+	numPals   int  // number of ACT files written
+	numEmpty  int  // number of zero-size sprites without valid link
+	skipImage bool // v1: the sprite being read is outside -range, only its palette is needed
+	lazy      bool // opened with OpenSff, sprites are decoded on demand instead of saved
+	savePals  bool // -pal without --no-act: write an ACT file for every palette
+
+	dirs       map[string]bool // -group-dirs and -thumbs directories already created
+	uniformPal int             // v1: palette index every sprite is drawn with for -uniform-pal, -1 until read
+
+	numUnsupported int   // sprites skipped because of an unsupported format
+	numPalAtEnd    int   // SFF v1 sprites flagged with the same palette that end with a palette anyway
+	savedBytes     int64 // size of the image and ACT files written
+	interrupted    int   // number of sprites in the header when Ctrl-C stopped the extraction, 0 otherwise
+
+	decodeTime time.Duration // time spent decoding the sprite being saved, for -timings
 }
 type Palette struct {
 	palList PaletteList
 }
 
 func newSff() (s *Sff) {
-	s = &Sff{sprites: make(map[[2]int16]*Sprite)}
+	s = &Sff{sprites: make(map[[2]int16][]*Sprite), dirs: make(map[string]bool), sharedPal: -1, uniformPal: -1}
 	s.palList.init()
 	for i := int16(1); i <= int16(MaxPalNo); i++ {
 		s.palList.PalTable[[...]int16{1, i}], _ = s.palList.NewPal()
@@ -887,21 +1924,107 @@ func newSff() (s *Sff) {
 }
 
 func extractSff(filename string, cmdSavePalette bool) (*Sff, error) {
-	char := true
-	s := newSff()
-	s.filename = filename
+	if filename == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading stdin: %v", err)
+		}
+		return extractSffReader(bytes.NewReader(data), "stdin.sff", cmdSavePalette)
+	}
+	f := physfs.OpenRead(filename)
+	if f == nil && optPassword != "" {
+		// physfs takes the password of an encrypted zip entry appended to its name
+		f = physfs.OpenRead(filename + "$" + optPassword)
+	}
+	if f == nil {
+		return nil, fmt.Errorf("File not found: %v", filename)
+	}
+	defer f.Close()
+	return extractSffReader(f, filename, cmdSavePalette)
+}
+
+// OpenSff parses an sff without writing any file. The compressed data of every sprite is kept
+// in memory so a sprite can be decoded on demand:
+//
+//	sff, err := OpenSff("kfm.sff")
+//	img, err := sff.GetSprite(9000, 0).Decode()
+func OpenSff(filename string) (*Sff, error) {
 	f := physfs.OpenRead(filename)
 	if f == nil {
-		return nil, fmt.Errorf(fmt.Sprintf("File not found: %v", filename))
+		return nil, fmt.Errorf("File not found: %v", filename)
 	}
 	defer f.Close()
+	return loadSff(context.Background(), f, filename, false, true)
+}
+
+// extractSffReader extracts sprites from an SFF read from any seekable source.
+// filename is used to derive the output filenames.
+// With -timeout the extraction stops with an error once the file takes longer than the timeout.
+func extractSffReader(f io.ReadSeeker, filename string, cmdSavePalette bool) (*Sff, error) {
+	ctx := context.Background()
+	if optTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, optTimeout)
+		defer cancel()
+	}
+	return loadSff(ctx, f, filename, cmdSavePalette, false)
+}
+
+// loadSff reads an sff and saves its sprites, or with lazy only keeps their compressed data for Sprite.Decode.
+// ctx is checked before every sprite, the sprites saved until it is done are kept.
+func loadSff(ctx context.Context, f io.ReadSeeker, filename string, cmdSavePalette bool, lazy bool) (*Sff, error) {
+	char := true
+	s := newSff()
+	s.filename = filename
+	s.lazy = lazy
+	s.savePals = cmdSavePalette && !optNoACT
+	s.outbase = strings.TrimSuffix(filename, filepath.Ext(filename))
+	if optFlattenDir != "" {
+		// The directories of the sff become part of the name so sff files with the same name do not collide
+		s.outbase = filepath.Join(optFlattenDir, strings.ReplaceAll(filepath.ToSlash(filepath.Clean(s.outbase)), "/", "_"))
+	} else if optOutputDir != "" {
+		s.outbase = filepath.Join(optOutputDir, s.outbase)
+	}
+	if zipOutput != nil && !optDryRun && !lazy {
+		// The archive needs no directories, the TSV rows start over like below
+		delete(zipTsv, zipName(s.outbase+".tsv"))
+		for _, r := range optSplit {
+			delete(zipTsv, zipName(splitOutbase(s.outbase, r)+".tsv"))
+		}
+	} else if !optDryRun && !lazy {
+		// The directory may not exist on disk when the sff comes from -o, -r or -archive
+		if err := os.MkdirAll(filepath.Dir(s.outbase), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("Error creating directory %v: %v", filepath.Dir(s.outbase), err)
+		}
+		// Rows are appended per sprite, start from an empty TSV so a second run gives the same file
+		if err := os.Remove(s.outbase + ".tsv"); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Error removing file %v: %v", s.outbase+".tsv", err)
+		}
+		for _, r := range optSplit {
+			outbase := splitOutbase(s.outbase, r)
+			if err := os.MkdirAll(filepath.Dir(outbase), os.ModePerm); err != nil {
+				return nil, fmt.Errorf("Error creating directory %v: %v", filepath.Dir(outbase), err)
+			}
+			if err := os.Remove(outbase + ".tsv"); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("Error removing file %v: %v", outbase+".tsv", err)
+			}
+		}
+	}
 	var lofs, tofs uint32
 	if err := s.header.Read(f, &lofs, &tofs); err != nil {
 		return nil, err
 	}
+	if offsetsWriter != nil && !lazy {
+		fmt.Fprintf(offsetsWriter, "; %v\n", filename)
+	}
 	read := func(x interface{}) error {
 		return binary.Read(f, binary.LittleEndian, x)
 	}
+	if s.header.Ver0 != 1 && s.header.NumberOfSprites == 0 && s.header.NumberOfPalettes > 0 && !lazy && !s.savePals && !optNoACT {
+		// A shared palette file, its palettes are the only thing to extract
+		fmt.Printf("%v has no sprites, saving its %v palettes\n", filename, s.header.NumberOfPalettes)
+		s.savePals = true
+	}
 	if s.header.Ver0 != 1 {
 		uniquePals := make(map[[2]int16]int)
 		for i := 0; i < int(s.header.NumberOfPalettes); i++ {
@@ -923,7 +2046,8 @@ func extractSff(filename string, cmdSavePalette bool) (*Sff, error) {
 			}
 			var pal []uint32
 			var idx int
-			if old, ok := uniquePals[[...]int16{gn_[0], gn_[1]}]; ok {
+			old, dup := uniquePals[[...]int16{gn_[0], gn_[1]}]
+			if dup {
 				idx = old
 				pal = s.palList.Get(old)
 				fmt.Printf("%v duplicated palette: %v,%v (%v/%v)\n", filename, gn_[0], gn_[1], i+1, s.header.NumberOfPalettes)
@@ -931,7 +2055,8 @@ func extractSff(filename string, cmdSavePalette bool) (*Sff, error) {
 				idx = int(link)
 				pal = s.palList.Get(idx)
 			} else {
-				f.Seek(int64(lofs+ofs), 0)
+				f.Seek(int64(lofs)+int64(ofs), 0)
+				// A palette of siz/4 < 256 colors leaves the other entries transparent black, see normalizePalette
 				pal = make([]uint32, 256)
 				var rgba [4]byte
 				for i := 0; i < int(siz)/4 && i < len(pal); i++ {
@@ -947,12 +2072,28 @@ func extractSff(filename string, cmdSavePalette bool) (*Sff, error) {
 					}
 					pal[i] = uint32(rgba[3])<<24 | uint32(rgba[2])<<16 | uint32(rgba[1])<<8 | uint32(rgba[0])
 				}
-				if cmdSavePalette {
-					savePalette(pal, fmt.Sprintf("%v %v %v.act", filename[:len(filename)-4], gn_[0], gn_[1]))
-				}
+				applyTransparentIndex(pal)
 				idx = i
 			}
+			if lazy || dup || siz == 0 && !optPalLinked {
+				// keep the palette only
+			} else if optPalCombined != "" {
+				addCombinedPalette(gn_[0], gn_[1], pal)
+			} else if s.savePals {
+				colors := int(gn_[2])
+				if colors <= 0 || colors > len(pal) {
+					colors = len(pal)
+				}
+				actFilename := fmt.Sprintf("%v %v %v.act", s.outbase, groupNo(gn_[0]), groupNo(gn_[1]))
+				s.savePalette(pal[:colors], actFilename)
+				if optPalSwatch {
+					if err := savePaletteSwatch(pal[:colors], actFilename); err != nil {
+						fmt.Println(err)
+					}
+				}
+			}
 			uniquePals[[...]int16{gn_[0], gn_[1]}] = idx
+			s.palList.headers = append(s.palList.headers, [...]int16{gn_[0], gn_[1]})
 			s.palList.SetSource(i, pal)
 			s.palList.PalTable[[...]int16{gn_[0], gn_[1]}] = idx
 			s.palList.numcols[[...]int16{gn_[0], gn_[1]}] = int(gn_[2])
@@ -968,50 +2109,174 @@ func extractSff(filename string, cmdSavePalette bool) (*Sff, error) {
 			}
 		}
 	}
+	if s.header.Ver0 == 1 && optSharedPal != nil {
+		s.sharedPal, _ = s.palList.NewPal()
+		s.palList.SetSource(s.sharedPal, optSharedPal)
+	}
+	if optPaletteBank > 0 {
+		if err := s.selectPaletteBank(optPaletteBank); err != nil {
+			return nil, err
+		}
+	}
+	if optUniformPal && s.header.Ver0 == 1 {
+		s.uniformPal = s.sharedPal
+	} else if optUniformPal {
+		if err := s.useUniformPalette(); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyRemap(&s.palList, optRemap); err != nil {
+		return nil, err
+	}
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
 	spriteList := make([]*Sprite, int(s.header.NumberOfSprites))
 	var prev *Sprite
+	withData := 0 // sprites with their own pixels, neither linked nor empty
 	shofs := int64(s.header.FirstSpriteHeaderOffset)
 	for i := 0; i < len(spriteList); i++ {
+		if interrupted.Load() && !lazy {
+			s.interrupted = len(spriteList)
+			spriteList = spriteList[:i]
+			break
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%v: aborted after %v of %v sprites, the file took longer than -timeout %v", filename, i, len(spriteList), optTimeout)
+		} else if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		f.Seek(shofs, 0)
 		spriteList[i] = newSprite()
 		var xofs, size uint32
 		var indexOfPrevious uint16
+		var headerErr error
 		switch s.header.Ver0 {
 		case 1:
-			if err := spriteList[i].readHeader(f, &xofs, &size,
-				&indexOfPrevious); err != nil {
-				return nil, err
+			if shofs < 32 || shofs+32 > fileSize {
+				headerErr = fmt.Errorf("sprite header offset %v is outside the file", shofs)
+			} else {
+				headerErr = spriteList[i].readHeader(f, &xofs, &size, &indexOfPrevious)
 			}
 		case 2:
-			if err := spriteList[i].readHeaderV2(f, &xofs, &size,
-				lofs, tofs, &indexOfPrevious); err != nil {
+			if shofs+28 > fileSize {
+				headerErr = fmt.Errorf("sprite header offset %v is outside the file", shofs)
+			} else if headerErr = spriteList[i].readHeaderV2(f, &xofs, &size,
+				lofs, tofs, &indexOfPrevious); headerErr == nil && int64(xofs) > fileSize {
+				// Data starting inside the file but cut short by its end is padded by readData
+				headerErr = fmt.Errorf("sprite data %v+%v is outside the file", xofs, size)
+			}
+		}
+		if headerErr != nil {
+			// Some tools write a NumberOfSprites larger than the real number of sprites
+			if optStrict {
+				return nil, fmt.Errorf("%v sprite %v: %v", filename, i, headerErr)
+			}
+			fmt.Printf("Warning: %v sprite %v: %v, keeping the first %v of %v sprites\n", filename, i, headerErr, i, len(spriteList))
+			spriteList = spriteList[:i]
+			break
+		}
+		// Palettes past the ones of the file are the empty placeholders of newSff, true-color sprites use none
+		if s.header.Ver0 != 1 && spriteList[i].coldepth <= 8 &&
+			(spriteList[i].palidx >= int(s.header.NumberOfPalettes) || !s.palList.Has(spriteList[i].palidx)) {
+			err := fmt.Errorf("%v sprite %v (%v,%v): palette %v does not exist (%v palettes)", filename, i,
+				spriteList[i].Group, spriteList[i].Number, spriteList[i].palidx, s.header.NumberOfPalettes)
+			if optStrict {
 				return nil, err
 			}
+			fmt.Printf("Warning: %v, using palette 0\n", err)
+			spriteList[i].palidx = 0
 		}
+		key := [...]int16{spriteList[i].Group, spriteList[i].Number}
+		spriteList[i].index = i
+		spriteList[i].dup = len(s.sprites[key]) > 0
+		if optGroupDirs && zipOutput == nil && !lazy && !optDryRun && (size != 0 || optWriteLinked) && inRange(i) && spriteSelected(spriteList[i]) {
+			if err := s.makeGroupDir(spriteList[i]); err != nil {
+				return nil, err
+			}
+		}
+		empty := false
+		// The link index only counts for a sprite without data, which takes the pixels of the linked
+		// sprite and keeps its own palette. A v2 sprite with data is read from its own offset even when
+		// the offset is shared with another sprite, so a palette-only variant of an image decodes with its palette.
 		if size == 0 {
 			if int(indexOfPrevious) < i {
 				dst, src := spriteList[i], spriteList[int(indexOfPrevious)]
 				dst.shareCopy(src)
+				dst.linkedTo = src
+				if s.header.Ver0 == 1 {
+					// The v1 "same palette as previous image" flag refers to the previous sprite in the file,
+					// a linked sprite included, its palette is the one of the sprite it links to
+					prev = dst
+				}
+				if lazy {
+					dst.compressed, dst.rle = src.compressed, src.rle
+				} else if optWriteLinked && src.data != nil && inRange(i) && spriteSelected(dst) {
+					if err := saveLinked(s, dst, src); err != nil {
+						return nil, err
+					}
+				} else if optSkipLinked && s.header.Ver0 != 1 && inRange(i) && spriteSelected(dst) {
+					if err := appendTsv(s.spriteOutbase(dst)+".tsv", dst, src, s.numColors(dst)); err != nil {
+						return nil, err
+					}
+				}
 			} else {
 				spriteList[i].palidx = 0 // index out of range
+				empty = true
+				s.numEmpty++
 			}
 		} else {
+			withData++
+			s.skipImage = !inRange(i)
 			switch s.header.Ver0 {
 			case 1:
-				if err := spriteList[i].read(f, s, shofs+32, size, xofs, prev, &s.palList, char && (prev == nil || spriteList[i].Group == 0 && spriteList[i].Number == 0)); err != nil {
-					return nil, err
+				// A next subheader outside the file ends the sprite list below, it cannot give the data size
+				next := xofs
+				if int64(next) > fileSize {
+					next = 0
+				}
+				// Sprites outside -range are still read for the palette shared with the next sprite
+				if err := spriteList[i].read(f, s, shofs+32, size, next, prev, &s.palList, char && (prev == nil || spriteList[i].Group == 0 && spriteList[i].Number == 0)); errors.Is(err, errUnsupportedFormat) && !optStrict {
+					fmt.Printf("Warning: %v sprite %v (%v,%v): %v, skipped\n", filename, i, spriteList[i].Group, spriteList[i].Number, err)
+					s.numUnsupported++
+				} else if err != nil {
+					return nil, fmt.Errorf("%v sprite %v (%v,%v): %v", filename, i, spriteList[i].Group, spriteList[i].Number, err)
 				}
 			case 2:
-				if err := spriteList[i].readV2(f, int64(xofs), size, s); err != nil {
-					return nil, err
+				if lazy {
+					compressed, err := spriteList[i].readData(f, int64(xofs), size, s)
+					if err != nil {
+						return nil, fmt.Errorf("%v sprite %v (%v,%v): %v", filename, i, spriteList[i].Group, spriteList[i].Number, err)
+					}
+					spriteList[i].compressed = compressed
+					break
 				}
+				if s.skipImage || !spriteSelected(spriteList[i]) {
+					break
+				}
+				if err := spriteList[i].readV2(f, int64(xofs), size, s); errors.Is(err, errUnsupportedFormat) && !optStrict {
+					fmt.Printf("Warning: %v sprite %v (%v,%v): %v, skipped\n", filename, i, spriteList[i].Group, spriteList[i].Number, err)
+					s.numUnsupported++
+				} else if err != nil {
+					return nil, fmt.Errorf("%v sprite %v (%v,%v): %v", filename, i, spriteList[i].Group, spriteList[i].Number, err)
+				}
+			}
+			if optStats {
+				recordCompression(s, spriteList[i], size)
 			}
 			prev = spriteList[i]
 		}
-		if s.sprites[[...]int16{spriteList[i].Group, spriteList[i].Number}] ==
-			nil {
-			s.sprites[[...]int16{spriteList[i].Group, spriteList[i].Number}] =
-				spriteList[i]
+		if csvWriter != nil && !lazy {
+			writeSpriteCsv(s, spriteList[i], size, empty)
+		}
+		if ndjsonWriter != nil && !lazy {
+			if err := writeSpriteNDJSON(s, spriteList[i], size, empty); err != nil {
+				return nil, err
+			}
+		}
+		if !(empty && optSkipEmpty) {
+			s.sprites[key] = append(s.sprites[key], spriteList[i])
 		}
 		if s.header.Ver0 == 1 {
 			shofs = int64(xofs)
@@ -1020,86 +2285,987 @@ func extractSff(filename string, cmdSavePalette bool) (*Sff, error) {
 		}
 		//~ fmt.Printf("Loading sprite %v/%v: %v,%v %v compressed_size=%v\n", i+1, len(spriteList), spriteList[i].Group, spriteList[i].Number, spriteList[i].Size, size)
 	}
+	s.spriteList = spriteList
+	if withData == 0 && len(spriteList) > 0 && s.header.NumberOfPalettes > 0 && !lazy && !s.savePals {
+		fmt.Printf("%v has no sprite data, only links and palettes, use -pal to save its palettes\n", filename)
+	}
+	if s.numPalAtEnd > 0 && !lazy {
+		fmt.Printf("%v has %v sprites flagged with the same palette that end with a palette of their own, use -v1-palette-at-end if their colors are wrong\n", filename, s.numPalAtEnd)
+	}
+	if lazy {
+		for _, spr := range spriteList {
+			spr.Pal = spr.outputPal(&s.palList)
+		}
+	} else if optGodot && !optDryRun {
+		if err := writeGodotResource(s); err != nil {
+			return nil, err
+		}
+	}
 	// C.print_info()
 	return s, nil
 }
+
+// inRange reports whether sprite index i is selected by -range
+func inRange(i int) bool {
+	return i >= optRangeStart && (optRangeEnd < 0 || i < optRangeEnd)
+}
+
+// spriteSelected reports whether the size of sprite s is within -min-size and -max-size
+// and, with -split, its group is in one of the ranges
+func spriteSelected(s *Sprite) bool {
+	if _, ok := splitRange(s.Group); len(optSplit) > 0 && !ok {
+		return false
+	}
+	w, h := int(s.Size[0]), int(s.Size[1])
+	if w < optMinSize[0] || h < optMinSize[1] {
+		return false
+	}
+	return (optMaxSize[0] == 0 || w <= optMaxSize[0]) && (optMaxSize[1] == 0 || h <= optMaxSize[1])
+}
+
+// parseSize parses a WxH size given to -min-size or -max-size
+func parseSize(v string) ([2]int, error) {
+	ws, hs, found := strings.Cut(strings.ToLower(v), "x")
+	w, err1 := strconv.Atoi(ws)
+	h, err2 := strconv.Atoi(hs)
+	if !found || err1 != nil || err2 != nil || w < 0 || h < 0 {
+		return [2]int{}, fmt.Errorf("Error: size must be WxH, got %v", v)
+	}
+	return [2]int{w, h}, nil
+}
+
+// parseRange parses -range start:end, end may be empty to mean up to the last sprite
+func parseRange(v string) (int, int, error) {
+	first, last, found := strings.Cut(v, ":")
+	start, err := strconv.Atoi(first)
+	if !found || err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("Error: -range requires start:end, got %v", v)
+	}
+	if last == "" {
+		return start, -1, nil
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("Error: -range requires start:end with end >= start, got %v", v)
+	}
+	return start, end, nil
+}
+
+// selectPaletteBank renders the sprites drawn with the first player palette [1,1]
+// with palette [1,bank] instead, like choosing another color in game
+func (s *Sff) selectPaletteBank(bank int) error {
+	if s.header.Ver0 == 1 {
+		return fmt.Errorf("%v: SFF v1 has no palette bank", s.filename)
+	}
+	dst, ok := s.palList.PalTable[[...]int16{1, int16(bank)}]
+	if !ok || dst < 0 {
+		return fmt.Errorf("%v: palette bank %v not found (%v palettes)", s.filename, bank, s.header.NumberOfPalettes)
+	}
+	src, ok := s.palList.PalTable[[...]int16{1, 1}]
+	if !ok || src < 0 {
+		return fmt.Errorf("%v: palette 1,1 not found", s.filename)
+	}
+	s.palList.Remap(src, dst)
+	return nil
+}
+
+// useUniformPalette draws every sprite with palette [1,1], after -palette the selected bank,
+// whatever palette its header refers to
+func (s *Sff) useUniformPalette() error {
+	src, ok := s.palList.PalTable[[...]int16{1, 1}]
+	if !ok || src < 0 {
+		return fmt.Errorf("%v: palette 1,1 not found", s.filename)
+	}
+	dst := s.palList.paletteMap[src]
+	for i := range s.palList.paletteMap {
+		s.palList.Remap(i, dst)
+	}
+	return nil
+}
+
+// ForEachSprite calls fn for every sprite in file order and stops at the first error
+func (s *Sff) ForEachSprite(fn func(*Sprite) error) error {
+	for _, spr := range s.spriteList {
+		if err := fn(spr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpriteSet is a collection of sprites, Sff implements it to hand its sprites to image pipelines:
+//
+//	for i := 0; i < set.Len(); i++ {
+//		img, err := set.At(i).Decode()
+//	}
+type SpriteSet interface {
+	Len() int                     // number of sprites
+	At(i int) *Sprite             // sprite i in file order
+	GetSprite(g, n int16) *Sprite // first sprite group,number, nil when missing
+}
+
+// Len returns the number of sprites of the sff
+func (s *Sff) Len() int {
+	return len(s.spriteList)
+}
+
+// At returns sprite i in file order
+func (s *Sff) At(i int) *Sprite {
+	return s.spriteList[i]
+}
+
+// GetSprite returns the first sprite of the file with group g and number n
 func (s *Sff) GetSprite(g, n int16) *Sprite {
 	if g == -1 {
 		return nil
 	}
-	return s.sprites[[...]int16{g, n}]
+	if list := s.sprites[[...]int16{g, n}]; len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+// formatSize returns n bytes in B, KB or MB
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%v B", n)
+}
+
+// printSummary prints the result of extracting sff
+func printSummary(sff *Sff) {
+	if optSingle != "" {
+		fmt.Printf("Extract %v (v%d.%d.%d) into %v pages of %v", sff.filename, sff.header.Ver0, sff.header.Ver1, sff.header.Ver2, sff.numSaved, optSingle)
+	} else {
+		fmt.Printf("Extract %v (v%d.%d.%d) into %v %v files", sff.filename, sff.header.Ver0, sff.header.Ver1, sff.header.Ver2, sff.numSaved, strings.ToUpper(optFormat))
+	}
+	if sff.numPals > 0 && optPalFormat == "png" {
+		fmt.Printf(" and %v palette PNG files", sff.numPals)
+	} else if sff.numPals > 0 {
+		fmt.Printf(" and %v ACT files", sff.numPals)
+	}
+	if sff.savedBytes > 0 {
+		fmt.Printf(" (%v)", formatSize(sff.savedBytes))
+	}
+	if sff.numUnsupported > 0 {
+		fmt.Printf(", skipped %v sprites of unsupported format", sff.numUnsupported)
+	}
+	if sff.interrupted > 0 {
+		fmt.Printf(", interrupted after %v of %v sprites", len(sff.spriteList), sff.interrupted)
+	}
+	if sff.numEmpty > 0 {
+		if optSkipEmpty {
+			fmt.Printf(", skipped %v empty sprites", sff.numEmpty)
+		} else {
+			fmt.Printf(", %v empty sprites have no file", sff.numEmpty)
+		}
+	}
+	fmt.Printf("\n")
+}
+
+func printUsage() {
+	fmt.Println(`Usage:
+	sffcli
+	sffcli -pal
+	sffcli -pal [char1.sff] [char2.sff] ...
+	sffcli -def char.def
+	sffcli - < char.sff
+	sffcli info [char1.sff] [char2.sff] ...
+	sffcli repl char.sff
+	sffcli version [--json]
+
+Commands:
+info: print the header, palettes and sprite statistics of sff files without extracting
+repl: open an sff once and list, show sprites or palettes with commands read from stdin (type help)
+version, --version: print the version, build commit, Go version and supported formats, --json for machine-readable output
+
+Options:
+-o dir: write output files below dir, mirroring the directory of each sff
+-mount dir: also look for sff files in dir, can be repeated, the current directory is searched first
+-writedir dir: set the physfs write directory, and write the output files below dir unless -o is given
+-flatten-dir dir: write the output files of every sff directly into dir, named after the sff and its directories (chars/kfm.sff gives "chars_kfm ...")
+-r, --recursive: when no sff is given, also extract sff files found in subdirectories
+-jf N: when no sff is given, extract N sff files at the same time, read from the real file system instead of physfs (default: the number of CPUs, 1 extracts them in order through physfs; ignored with -contact-sheet, -single, -pal-combined, -stats, -dry-run, -hashes, -timings, -csv and -offsets)
+-mem-budget MB: with -jf, limit the decoded sprites held at the same time to MB megabytes, counting width*height bytes per indexed sprite and 4 bytes per pixel for true-color ones. A sprite larger than the budget is decoded alone
+-no-overwrite, -skip-existing: keep output files that already exist, useful to resume an interrupted extraction
+-range start:end: only decode and save sprites with index start <= i < end in the file, end may be left empty
+-max-dim N: SFF v1, reject PCX sprites wider or taller than N as corrupt (default 8192)
+-max-pixels N: refuse to decode sprites with more than N pixels (default 16777216, 0 for no limit)
+-timeout 30s: stop extracting an sff that takes longer than the duration and go on with the next file, checked between sprites (default no limit)
+-write-linked: write linked sprites (sprites reusing the pixels of another one) as their own file
+-skip-linked: write no file for linked sprites and record the sprite they link to in the last column of the TSV file
+-force-version 1|2: parse the sff as SFF v1 or v2 whatever its version bytes say, to recover a file whose version is damaged
+-strict: fail on a sprite header or sprite data outside the file instead of keeping the sprites read so far, and on a sprite of unsupported format instead of skipping it
+-thumbs N: also save every sprite shrunk to at most N pixels on its longest side, same name in a "thumbs" directory next to the image
+-group-dirs: save sprites as "<name>/<group>/<number>.png", one directory per group next to the TSV file
+-split 0:9999,10000:19999: save the sprites of each group range into its own directory "<name> <start>-<end>", sprites of other groups are not saved
+-min-size WxH: only save sprites at least W wide and H high
+-max-size WxH: only save sprites at most W wide and H high, 0 for no limit in one direction
+-skip-empty: leave zero-size sprites that link to nothing out of the sprite list (they never produce a file)
+-dry-run: report the files that would be written and their estimated size without creating anything
+-archive file.zip: extract every sff inside a zip or pk3 archive into a directory named after it (7z and other formats are not compiled into physfs)
+-password pw: password of encrypted zip entries, give it before -archive
+-: read the sff from stdin, output files are named stdin
+-pal: save palette as ACT file
+-extract-pal group,number out.act char.sff: only save the palette used by sprite group,number of char.sff to out.act
+-compare a.sff b.sff: only report the sprites (matched by group,number) added, removed or with different pixels in b.sff, and the SFF v2 palettes that differ
+-diff-dir DIR: with -compare, write "<group> <number> diff.png" into DIR, below -o unless the path is absolute, for every changed sprite, differing pixels in red over the faded sprite of b.sff
+-list-pal char.sff: print the group,number, number of colors and link of every SFF v2 palette of char.sff
+-extract-pal-gn group,number out.act char.sff: only save SFF v2 palette group,number (not a sprite group,number) of char.sff to out.act
+--no-act: write no ACT file, even with -pal or -quantize (SFF v1 palettes are only saved with -pal)
+-pal-linked: save palette as ACT file, SFF v2 linked palettes too as a copy of the palette they link to
+-palfmt act|png: file format of the palettes saved by -pal and -quantize, png writes "<name> <group> <number>.pal.png", a 16x16 indexed PNG with pixel x,y of index y*16+x so its PLTE chunk is the palette (default act)
+-pal-swatch: save palette as ACT file and as a PNG of 16x16 color cells ("<name> <group> <number>.swatch.png")
+-pal-combined pals.pal: save all unique palettes into one file ("SPAL", count, group,number of each, then 768 bytes RGB per palette) instead of one ACT per palette, below -o unless the path is absolute
+-def char.def: extract the sff referenced by char.def and name sprites by the actions in its air file
+-names names.csv: add the name of group,number,name rows to the sprite filenames ("<name> <group> <number> <sprite name>"), an empty number names the whole group; takes precedence over -def action names
+-character kfm.zip: like -def for the character def inside a zip or pk3 archive, its sff is extracted into a directory named after the archive
+-transparent-index N: use palette index N as transparent color instead of index 0
+-format png|tga|tiff: output image format (default png), tga is written as 32-bit BGRA, tiff keeps indexed sprites indexed
+-single out.tiff: write all sprites as the pages of one multi-page TIFF instead of one file per sprite (implies -format tiff), below -o unless the path is absolute
+-keep-pcx: SFF v1, also write the PCX data of every sprite as stored in the sff, with its palette, to a .pcx file next to the image
+-keep-raw: SFF v2, also write the RLE8, RLE5 and LZ5 data of every sprite as stored in the sff to a .rle8, .rle5 or .lz5 file next to the image, with its WxH size in a .size file
+-trns: write indexed PNG with an opaque RGB palette and a tRNS chunk marking only the transparent index, ignoring palette alpha
+-bg R,G,B: fill transparent pixels with color R,G,B so every image is opaque, for tools that ignore the alpha channel
+-premultiply: write sprites as true-color images with premultiplied alpha (color channels multiplied by alpha), tiff marks the alpha as associated
+-png16: write sprites as true-color PNG with 16 bits per channel (NRGBA64) instead of indexed
+-crop x,y,w,h: only extract the w x h region at x,y of every sprite and adjust its offset, with -range to pick the sprites
+-trim: crop transparent borders of sprites and adjust their offset (written to the TSV file)
+-scale N: enlarge sprites N times (1..8) with nearest neighbor, indexed sprites stay indexed and offsets are scaled too
+-flip h|v|both: mirror sprites left-right, top-bottom or both, offsets are mirrored too so the axis stays on the same pixel
+-quantize: convert true-color (PNG24/PNG32) sprites to 256 colors with median cut and save their palette as ACT next to the image
+-index-palette: convert true-color (PNG24/PNG32) sprites to the palette of the sff (or -apply-pal) instead, so every image shares the same palette
+-quantize-quality N: 1..10, with lower values the -quantize palette is built from fewer pixels, faster but less accurate (default 10)
+-contact-sheet out.png: also write one image showing every sprite in a grid labeled with its group,number, below -o unless the path is absolute
+-contact-cols N: number of columns in the contact sheet (default 10)
+-palette N: render sprites using the first player palette (1,1) with player palette 1,N, like the costume colors in game
+-uniform-pal: render every sprite with the first player palette (1,1), or the -palette bank, whatever palette it refers to, for a consistent preview (SFF v1: the palette of the first sprite or -shared-pal)
+-remap src:dst,...: render sprites using palette src with palette dst instead, dst is a palette index or an ACT file
+-apply-pal custom.act: recolor every indexed sprite with the palette from custom.act
+-pal-cycle p1.act,p2.act,...: palettes of the frames written by -gif
+-gif-delay N: delay between -gif frames in 1/100 s (default 10)
+-gif out.gif group,number char.sff: only render sprite group,number of char.sff once with each -pal-cycle palette into an animated GIF, below -o unless the path is absolute
+-portraits out.png char.sff: only draw the small (9000,0) and large (9000,1) portraits of char.sff side by side into out.png, below -o unless the path is absolute
+-shared-pal char.act: SFF v1, use the Mugen ACT palette (e.g. pal1 of the def) for sprites flagged with the same palette
+-v1-palette-at-end: SFF v1, sprites flagged with the same palette that still end with a palette are drawn with that palette
+-unsigned-groups: print group and number above 32767 as unsigned instead of negative
+-hashes hashes.txt: write group,number,crc32 of the pixels and palette of every sprite
+-csv sprites.csv: write index,group,number,width,height,xoffset,yoffset,coldepth,format,palidx,filename of every sprite in file order
+-ozip out.zip: write the sprite images, palettes, TSV files and other per-sprite files into out.zip instead of the disk, in extraction order with the TSV files last
+-ndjson sprites.ndjson: write the -csv fields and the sff filename of every sprite as one JSON object per line, as soon as the sprite is read
+-godot: also write "<name>.tres", a Godot 4 SpriteFrames resource with one animation per sprite group whose frames are the saved image files (SpriteFrames has no per-frame offset, the axis stays in the TSV)
+-offsets offsets.ini: write a [group,number] section with the axis x, y and size w, h of every saved sprite
+-timings timings.csv: write group,number,decodeMicros,encodeMicros of every saved sprite (embedded PNG sprites are copied, decode is 0)
+-stats: print the compression ratio of each sprite format (stored size to decoded size) at the end
+-best-format: print the size of every indexed sprite encoded as RLE8, RLE5 and LZ5 and the smallest one, then the totals at the end`)
 }
 
 func main() {
 	cmdSavePalette := false
 	readAllDirectories := true
 
-	fmt.Printf("sffcli v1.0: tool to extract sprites (into PNG format) and palettes (into ACT format) from Mugen SFF (both v1 and v2)\nCompiled by leonkasovan@gmail.com, 16 Maret 2025\n\n")
+	if len(os.Args) > 1 && (os.Args[1] == "version" || os.Args[1] == "--version") {
+		printVersion(len(os.Args) > 2 && os.Args[2] == "--json")
+		return
+	}
+
+	fmt.Printf("sffcli v%v: tool to extract sprites (into PNG format) and palettes (into ACT format) from Mugen SFF (both v1 and v2)\nCompiled by leonkasovan@gmail.com, 16 Maret 2025\n\n", version)
 	if !physfs.Init(os.Args[0]) {
 		fmt.Println("Error: initialize file system")
 		return
 	}
 	defer physfs.Deinit()
 
-	// Mount the current directory
-	currentDir, _ := os.Getwd()
-	if !physfs.Mount(currentDir, "/", 1) {
-		fmt.Printf("Mounting directory \"%v\" [FAIL]\n", currentDir)
+	// Mount the current directory and the -mount directories
+	writeDir, err := parseMountOptions(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	currentDir := mountDirs[0]
+	for _, dir := range mountDirs {
+		if !physfs.Mount(dir, "/", 1) {
+			fmt.Printf("Mounting directory \"%v\" [FAIL]\n", dir)
+		}
 	}
 	// Set Write Directory
-	physfs.SetWriteDir(currentDir)
+	if !physfs.SetWriteDir(writeDir) {
+		fmt.Printf("Setting write directory \"%v\" [FAIL]\n", writeDir)
+	}
 
-	if len(os.Args[1:]) > 0 {
-		for _, arg := range os.Args[1:] {
-			if arg == "-pal" {
-				cmdSavePalette = true
-			} else if arg == "-h" || arg == "--help" {
-				readAllDirectories = false
-				fmt.Println("Usage:\n\tsffcli\n\tsffcli -pal\n\tsffcli -pal [char1.sff] [char2.sff] ...\n\nOptions:\n-pal: save palette as ACT file")
-			} else {
-				sff, err := extractSff(arg, cmdSavePalette)
+	if len(os.Args) > 2 && os.Args[1] == "repl" {
+		if err := runRepl(os.Args[2]); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		for _, arg := range os.Args[2:] {
+			if err := printSffInfo(arg); err != nil {
+				fmt.Println(err)
+			}
+		}
+		return
+	}
+
+	var i int
+	// nextArg consumes the value of an option
+	nextArg := func() (string, bool) {
+		if i+1 >= len(os.Args) {
+			return "", false
+		}
+		i++
+		return os.Args[i], true
+	}
+	intArg := func() (int, bool) {
+		v, ok := nextArg()
+		if !ok {
+			return 0, false
+		}
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	handleInterrupt()
+	for i = 1; i < len(os.Args) && !interrupted.Load(); i++ {
+		arg := os.Args[i]
+		if arg == "-pal" {
+			cmdSavePalette = true
+		} else if arg == "-pal-swatch" {
+			cmdSavePalette = true
+			optPalSwatch = true
+		} else if arg == "-palfmt" {
+			v, ok := nextArg()
+			if !ok || v != "act" && v != "png" {
+				fmt.Println("Error: -palfmt requires act or png")
+				return
+			}
+			optPalFormat = v
+		} else if arg == "-pal-linked" {
+			cmdSavePalette = true
+			optPalLinked = true
+		} else if arg == "-extract-pal" {
+			gn, ok1 := nextArg()
+			act, ok2 := nextArg()
+			file, ok3 := nextArg()
+			if !ok1 || !ok2 || !ok3 {
+				fmt.Println("Error: -extract-pal requires group,number, an ACT filename and an sff filename")
+				return
+			}
+			if err := extractSpritePalette(file, gn, act); err != nil {
+				fmt.Println(err)
+			}
+			return
+		} else if arg == "-compare" {
+			a, ok1 := nextArg()
+			b, ok2 := nextArg()
+			if !ok1 || !ok2 {
+				fmt.Println("Error: -compare requires two sff filenames")
+				return
+			}
+			if err := compareSff(a, b); err != nil {
+				fmt.Println(err)
+			}
+			return
+		} else if arg == "-diff-dir" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -diff-dir requires a directory")
+				return
+			}
+			optDiffDir = v
+		} else if arg == "-list-pal" {
+			file, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -list-pal requires an sff filename")
+				return
+			}
+			if err := listPalettes(file); err != nil {
+				fmt.Println(err)
+			}
+			return
+		} else if arg == "-extract-pal-gn" {
+			gn, ok1 := nextArg()
+			act, ok2 := nextArg()
+			file, ok3 := nextArg()
+			if !ok1 || !ok2 || !ok3 {
+				fmt.Println("Error: -extract-pal-gn requires group,number, an ACT filename and an sff filename")
+				return
+			}
+			if err := extractPaletteGroupNumber(file, gn, act); err != nil {
+				fmt.Println(err)
+			}
+			return
+		} else if arg == "--no-act" || arg == "-no-act" {
+			optNoACT = true
+		} else if arg == "-pal-combined" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -pal-combined requires a filename")
+				return
+			}
+			optPalCombined = v
+		} else if arg == "-h" || arg == "--help" {
+			readAllDirectories = false
+			printUsage()
+		} else if arg == "-transparent-index" {
+			v, ok := intArg()
+			if !ok || v < 0 || v > 255 {
+				fmt.Println("Error: -transparent-index requires a palette index 0..255")
+				return
+			}
+			optTransparentIndex = v
+		} else if arg == "-trim" {
+			optTrim = true
+		} else if arg == "-format" {
+			v, ok := nextArg()
+			if !ok || (v != "png" && v != "tga" && v != "tiff") {
+				fmt.Println("Error: -format requires png, tga or tiff")
+				return
+			}
+			optFormat = v
+		} else if arg == "-single" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -single requires a tiff filename")
+				return
+			}
+			optSingle = v
+			optFormat = "tiff"
+		} else if arg == "-contact-sheet" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -contact-sheet requires a png filename")
+				return
+			}
+			optContactSheet = v
+		} else if arg == "-contact-cols" {
+			v, ok := intArg()
+			if !ok || v < 1 {
+				fmt.Println("Error: -contact-cols requires a positive number")
+				return
+			}
+			optContactCols = v
+		} else if arg == "-hashes" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -hashes requires a filename")
+				return
+			}
+			fo, err := os.Create(v)
+			if err != nil {
+				fmt.Printf("Error creating file %v: %v\n", v, err)
+				return
+			}
+			defer fo.Close()
+			hashWriter = fo
+		} else if arg == "-timings" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -timings requires a csv filename")
+				return
+			}
+			fo, err := os.Create(v)
+			if err != nil {
+				fmt.Printf("Error creating file %v: %v\n", v, err)
+				return
+			}
+			defer fo.Close()
+			fmt.Fprintln(fo, "group,number,decodeMicros,encodeMicros")
+			timingWriter = fo
+		} else if arg == "-csv" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -csv requires a csv filename")
+				return
+			}
+			fo, err := os.Create(v)
+			if err != nil {
+				fmt.Printf("Error creating file %v: %v\n", v, err)
+				return
+			}
+			defer fo.Close()
+			fmt.Fprintln(fo, csvHeader)
+			csvWriter = fo
+		} else if arg == "-ndjson" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -ndjson requires a filename")
+				return
+			}
+			fo, err := os.Create(v)
+			if err != nil {
+				fmt.Printf("Error creating file %v: %v\n", v, err)
+				return
+			}
+			defer fo.Close()
+			ndjsonWriter = fo
+		} else if arg == "-ozip" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -ozip requires a zip filename")
+				return
+			}
+			fo, err := os.Create(v)
+			if err != nil {
+				fmt.Printf("Error creating file %v: %v\n", v, err)
+				return
+			}
+			defer fo.Close()
+			zipOutput = zip.NewWriter(fo)
+			zipPath = v
+			// Deferred so the modes returning early, like -gif, complete the archive as well
+			defer func() {
+				if err := closeZip(); err != nil {
+					fmt.Println(err)
+				} else if !optDryRun {
+					fmt.Printf("Zip %v created with %v files\n", zipPath, len(zipEntries)+len(zipTsv))
+				}
+			}()
+		} else if arg == "-offsets" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -offsets requires an ini filename")
+				return
+			}
+			fo, err := os.Create(v)
+			if err != nil {
+				fmt.Printf("Error creating file %v: %v\n", v, err)
+				return
+			}
+			defer fo.Close()
+			offsetsWriter = fo
+		} else if arg == "-stats" {
+			optStats = true
+		} else if arg == "-best-format" {
+			optBestFormat = true
+		} else if arg == "-unsigned-groups" {
+			optUnsignedGroups = true
+		} else if arg == "-remap" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -remap requires src:dst,...")
+				return
+			}
+			remaps, err := parseRemap(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optRemap = remaps
+		} else if arg == "-apply-pal" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -apply-pal requires an ACT filename")
+				return
+			}
+			pal, err := loadPalette(v, false)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optApplyPal = pal
+		} else if arg == "-pal-cycle" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -pal-cycle requires ACT filenames separated by commas")
+				return
+			}
+			optPalCycle = nil
+			for _, name := range strings.Split(v, ",") {
+				pal, err := loadPalette(name, false)
 				if err != nil {
 					fmt.Println(err)
-				} else {
-					readAllDirectories = false
-					fmt.Printf("Extract %v (v%d.%d.%d) into %v PNG files", sff.filename, sff.header.Ver0, sff.header.Ver1, sff.header.Ver2, len(sff.sprites))
-					if cmdSavePalette {
-						fmt.Printf(" and %v ACT files", len(sff.palList.PalTable))
-					}
-					fmt.Printf("\n")
+					return
 				}
+				optPalCycle = append(optPalCycle, pal)
+			}
+		} else if arg == "-gif-delay" {
+			v, ok := intArg()
+			if !ok || v < 0 {
+				fmt.Println("Error: -gif-delay requires a delay in 1/100 s")
+				return
+			}
+			optGifDelay = v
+		} else if arg == "-gif" {
+			out, ok1 := nextArg()
+			gn, ok2 := nextArg()
+			file, ok3 := nextArg()
+			if !ok1 || !ok2 || !ok3 {
+				fmt.Println("Error: -gif requires a GIF filename, group,number and an sff filename")
+				return
+			}
+			if err := writePaletteCycleGIF(namedOutput(out), gn, file); err != nil {
+				fmt.Println(err)
+			}
+			return
+		} else if arg == "-portraits" {
+			out, ok1 := nextArg()
+			file, ok2 := nextArg()
+			if !ok1 || !ok2 {
+				fmt.Println("Error: -portraits requires a PNG filename and an sff filename")
+				return
+			}
+			if err := writePortraits(namedOutput(out), file); err != nil {
+				fmt.Println(err)
+			}
+			return
+		} else if arg == "-mount" || arg == "-writedir" {
+			nextArg() // already applied by parseMountOptions
+		} else if arg == "-o" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -o requires a directory")
+				return
+			}
+			optOutputDir = v
+		} else if arg == "-flatten-dir" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -flatten-dir requires a directory")
+				return
+			}
+			optFlattenDir = v
+		} else if arg == "-jf" {
+			v, ok := intArg()
+			if !ok || v < 1 {
+				fmt.Println("Error: -jf requires a number of files of at least 1")
+				return
+			}
+			optFileJobs = v
+		} else if arg == "-mem-budget" {
+			v, ok := intArg()
+			if !ok || v < 1 {
+				fmt.Println("Error: -mem-budget requires a size in MB of at least 1")
+				return
+			}
+			memBudget = newBudget(int64(v) << 20)
+		} else if arg == "-r" || arg == "--recursive" {
+			optRecursive = true
+		} else if arg == "-no-overwrite" || arg == "-skip-existing" {
+			optNoOverwrite = true
+		} else if arg == "-dry-run" || arg == "--dry-run" {
+			optDryRun = true
+		} else if arg == "-shared-pal" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -shared-pal requires an ACT filename")
+				return
+			}
+			pal, err := loadPalette(v, true)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optSharedPal = pal
+		} else if arg == "-v1-palette-at-end" {
+			optV1PalAtEnd = true
+		} else if arg == "-skip-empty" {
+			optSkipEmpty = true
+		} else if arg == "-uniform-pal" {
+			optUniformPal = true
+		} else if arg == "-palette" {
+			v, ok := intArg()
+			if !ok || v < 1 || v > MaxPalNo {
+				fmt.Printf("Error: -palette requires a palette bank 1..%v\n", MaxPalNo)
+				return
+			}
+			optPaletteBank = v
+		} else if arg == "-range" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -range requires start:end")
+				return
+			}
+			start, end, err := parseRange(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optRangeStart, optRangeEnd = start, end
+		} else if arg == "-max-dim" {
+			v, ok := intArg()
+			if !ok || v < 1 || v > 65536 {
+				fmt.Println("Error: -max-dim requires a size 1..65536")
+				return
+			}
+			optMaxDim = v
+		} else if arg == "-max-pixels" {
+			v, ok := intArg()
+			if !ok || v < 0 {
+				fmt.Println("Error: -max-pixels requires a number of pixels, 0 for no limit")
+				return
+			}
+			optMaxPixels = v
+		} else if arg == "-timeout" {
+			v, ok := nextArg()
+			d, err := time.ParseDuration(v)
+			if !ok || err != nil || d <= 0 {
+				fmt.Println("Error: -timeout requires a duration like 30s or 2m")
+				return
+			}
+			optTimeout = d
+		} else if arg == "-write-linked" || arg == "-skip-linked" {
+			if optWriteLinked || optSkipLinked {
+				fmt.Println("Error: -write-linked and -skip-linked are mutually exclusive")
+				return
+			}
+			optWriteLinked = arg == "-write-linked"
+			optSkipLinked = arg == "-skip-linked"
+		} else if arg == "-scale" {
+			v, ok := intArg()
+			if !ok || v < 1 || v > 8 {
+				fmt.Println("Error: -scale requires a factor 1..8")
+				return
+			}
+			optScale = v
+		} else if arg == "-flip" {
+			v, ok := nextArg()
+			if !ok || v != "h" && v != "v" && v != "both" {
+				fmt.Println("Error: -flip requires h, v or both")
+				return
+			}
+			optFlip = v
+		} else if arg == "-password" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -password requires a password")
+				return
+			}
+			optPassword = v
+		} else if arg == "-archive" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -archive requires a zip or pk3 filename")
+				return
+			}
+			readAllDirectories = false
+			if err := extractArchive(v, cmdSavePalette); err != nil {
+				fmt.Println(err)
+			}
+		} else if arg == "-strict" {
+			optStrict = true
+		} else if arg == "-force-version" {
+			v, ok := intArg()
+			if !ok || v != 1 && v != 2 {
+				fmt.Println("Error: -force-version requires 1 or 2")
+				return
+			}
+			optForceVersion = byte(v)
+		} else if arg == "-quantize" {
+			optQuantize = true
+		} else if arg == "-index-palette" {
+			optIndexPalette = true
+		} else if arg == "-quantize-quality" {
+			v, ok := intArg()
+			if !ok || v < 1 || v > 10 {
+				fmt.Println("Error: -quantize-quality requires a quality 1..10")
+				return
+			}
+			optQuantizeQuality = v
+		} else if arg == "-keep-raw" {
+			optKeepRaw = true
+		} else if arg == "-keep-pcx" {
+			optKeepPCX = true
+		} else if arg == "-trns" {
+			optTRNS = true
+		} else if arg == "-godot" {
+			optGodot = true
+		} else if arg == "-premultiply" {
+			optPremultiply = true
+		} else if arg == "-crop" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -crop requires x,y,w,h")
+				return
+			}
+			r, err := parseCrop(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optCrop = &r
+		} else if arg == "-bg" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -bg requires R,G,B")
+				return
+			}
+			bg, err := parseColor(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optBackground = &bg
+		} else if arg == "-png16" {
+			optPNG16 = true
+		} else if arg == "-thumbs" {
+			v, ok := intArg()
+			if !ok || v < 1 {
+				fmt.Println("Error: -thumbs requires a size in pixels")
+				return
+			}
+			optThumbs = v
+		} else if arg == "-group-dirs" {
+			optGroupDirs = true
+		} else if arg == "-split" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -split requires start:end group ranges")
+				return
+			}
+			ranges, err := parseSplit(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			optSplit = ranges
+		} else if arg == "-min-size" || arg == "-max-size" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Printf("Error: %v requires WxH\n", arg)
+				return
+			}
+			size, err := parseSize(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if arg == "-min-size" {
+				optMinSize = size
+			} else {
+				optMaxSize = size
+			}
+		} else if arg == "-names" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -names requires a csv filename")
+				return
+			}
+			names, groups, err := loadSpriteNames(v)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			spriteNames, groupNames = names, groups
+		} else if arg == "-def" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -def requires a def filename")
+				return
+			}
+			def, err := loadCharDef(v)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			readAllDirectories = false
+			extractCharDef(def, cmdSavePalette)
+		} else if arg == "-character" {
+			v, ok := nextArg()
+			if !ok {
+				fmt.Println("Error: -character requires a zip or pk3 filename")
+				return
+			}
+			readAllDirectories = false
+			if err := extractCharacter(v, cmdSavePalette); err != nil {
+				fmt.Println(err)
+			}
+		} else {
+			sff, err := extractSff(arg, cmdSavePalette)
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				readAllDirectories = false
+				printSummary(sff)
 			}
 		}
 	}
 
-	if readAllDirectories {
-		// Read currentDir directory
+	if readAllDirectories && optRecursive {
+		// Walk the real directory trees, paths relative to a mounted directory are valid in the mounted physfs
+		var files []string
+		found := make(map[string]bool) // a file in more than one mounted directory is read from the first
+		isOutput := func(dir, path, out string) bool {
+			return out != "" && (path == filepath.Clean(out) || filepath.Join(dir, path) == filepath.Clean(out))
+		}
+		for _, dir := range mountDirs {
+			err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				path, _ = filepath.Rel(dir, path)
+				if d.IsDir() && (isOutput(dir, path, optOutputDir) || isOutput(dir, path, optFlattenDir)) {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() && strings.HasSuffix(strings.ToLower(path), ".sff") && !found[path] {
+					found[path] = true
+					files = append(files, filepath.ToSlash(path))
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Printf("failed to read directory %s: %v", dir, err)
+			}
+		}
+		extractFiles(files, cmdSavePalette)
+	} else if readAllDirectories {
+		// Read the mounted directories
 		entries, err := physfs.EnumerateFiles("/")
 		if err != nil {
 			fmt.Printf("failed to read directory %s: %v", currentDir, err)
 		}
+		sort.Strings(entries) // enumeration order depends on the file system
 
 		// Find sff file and process
+		var files []string
 		for _, file := range entries {
 			if strings.HasSuffix(file, ".sff") {
-
-				sff, err := extractSff(file, cmdSavePalette)
-				if err != nil {
-					fmt.Println(err)
-				} else {
-					fmt.Printf("Extract %v (v%d.%d.%d) into %v PNG files", sff.filename, sff.header.Ver0, sff.header.Ver1, sff.header.Ver2, len(sff.sprites))
-					if cmdSavePalette {
-						fmt.Printf(" and %v ACT files", len(sff.palList.PalTable))
-					}
-					fmt.Printf("\n")
-				}
+				files = append(files, file)
 			}
 		}
+		extractFiles(files, cmdSavePalette)
 	}
 
-	// Unmount current directory
-	if !physfs.Unmount(currentDir) {
-		fmt.Printf("Unmounting directory \"%v\" [FAIL]\n", currentDir)
-		return
+	if optContactSheet != "" {
+		if err := writeContactSheet(namedOutput(optContactSheet), optContactCols); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	if optSingle != "" {
+		if err := writeSingleTIFF(namedOutput(optSingle)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	if optPalCombined != "" {
+		if err := writeCombinedPalettes(namedOutput(optPalCombined)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	if optStats {
+		printStats()
+	}
+	if optBestFormat {
+		printBestFormats()
+	}
+
+	if optDryRun {
+		fmt.Printf("Dry run: %v files, %v bytes estimated\n", dryRunFiles, dryRunBytes)
+	}
+
+	// Unmount the directories
+	for _, dir := range mountDirs {
+		if !physfs.Unmount(dir) {
+			fmt.Printf("Unmounting directory \"%v\" [FAIL]\n", dir)
+			return
+		}
 	}
 }
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// decodeTestSprite decodes sprite g,n of sff and checks it is an indexed image of w*h pixels
+func decodeTestSprite(t *testing.T, sff *Sff, g, n int16, w, h int) *image.Paletted {
+	t.Helper()
+	s := sff.GetSprite(g, n)
+	if s == nil {
+		t.Fatalf("sprite %v,%v not found", g, n)
+	}
+	img, err := s.Decode()
+	if err != nil {
+		t.Fatalf("sprite %v,%v: %v", g, n, err)
+	}
+	p, ok := img.(*image.Paletted)
+	if !ok {
+		t.Fatalf("sprite %v,%v: got %T, want *image.Paletted", g, n, img)
+	}
+	if p.Rect.Dx() != w || p.Rect.Dy() != h {
+		t.Fatalf("sprite %v,%v: got %vx%v, want %vx%v", g, n, p.Rect.Dx(), p.Rect.Dy(), w, h)
+	}
+	return p
+}
+
+func TestDecodeV1(t *testing.T) {
+	pix := testPixels(37, 11, 256)
+	sff := openTestSff(t, buildTestSffV1(
+		testSprite{group: 0, number: 0, w: 37, h: 11, pix: pix, axis: [2]int16{18, 10}},
+		testSprite{group: 5, number: 1, w: 37, h: 11, pix: pix, samePal: true},
+		testSprite{group: 5, number: 2, link: 1},
+	))
+	if sff.header.Ver0 != 1 {
+		t.Errorf("got version %v, want 1", sff.header.Ver0)
+	}
+	if len(sff.spriteList) != 3 {
+		t.Fatalf("got %v sprites, want 3", len(sff.spriteList))
+	}
+	if s := sff.GetSprite(0, 0); s.Offset != [2]int16{18, 10} {
+		t.Errorf("got axis %v, want [18 10]", s.Offset)
+	}
+	pal := testPalette(0)
+	for _, gn := range [][2]int16{{0, 0}, {5, 1}} {
+		img := decodeTestSprite(t, sff, gn[0], gn[1], 37, 11)
+		if !bytes.Equal(img.Pix, pix) {
+			t.Errorf("sprite %v: pixels differ", gn)
+		}
+		if r, g, b, _ := img.Palette[200].RGBA(); r>>8 != pal[200]&0xff || g>>8 != pal[200]>>8&0xff || b>>8 != pal[200]>>16&0xff {
+			t.Errorf("sprite %v: got color 200 %v,%v,%v, want %08x", gn, r>>8, g>>8, b>>8, pal[200])
+		}
+	}
+	if s := sff.GetSprite(5, 2); s.linkedTo != sff.GetSprite(5, 1) || s.Size != [2]uint16{37, 11} {
+		t.Errorf("linked sprite: got size %v, linked to %p", s.Size, s.linkedTo)
+	}
+}
+
+func TestDecodeV2(t *testing.T) {
+	pix := testPixels(41, 13, 32)
+	sprites := []testSprite{
+		{group: 0, number: 0, w: 41, h: 13, pix: pix, format: 0},
+		{group: 1, number: 0, w: 41, h: 13, pix: pix, format: 2},
+		{group: 1, number: 1, w: 41, h: 13, pix: pix, format: 3, palidx: 1},
+		{group: 1, number: 2, w: 41, h: 13, pix: pix, format: 4},
+		{group: 2, number: 0, link: 3},
+	}
+	sff := openTestSff(t, buildTestSffV2([][]uint32{testPalette(0), testPalette(1)}, sprites...))
+	if sff.header.Ver0 != 2 {
+		t.Errorf("got version %v, want 2", sff.header.Ver0)
+	}
+	for _, s := range sprites[:4] {
+		img := decodeTestSprite(t, sff, s.group, s.number, s.w, s.h)
+		if !bytes.Equal(img.Pix, pix) {
+			t.Errorf("sprite %v,%v (format %v): pixels differ", s.group, s.number, s.format)
+		}
+		if _, g, _, _ := img.Palette[1].RGBA(); g>>8 != uint32(s.palidx) {
+			t.Errorf("sprite %v,%v: got palette with green %v, want palette %v", s.group, s.number, g>>8, s.palidx)
+		}
+	}
+	if s := sff.GetSprite(2, 0); s.linkedTo != sff.GetSprite(1, 2) {
+		t.Errorf("sprite 2,0 is not linked to sprite 1,2")
+	}
+}
+
+// Decode must leave the sprite as it is, the second decode returns the same pixels
+func TestDecodeTwice(t *testing.T) {
+	pix := testPixels(20, 20, 32)
+	for name, data := range map[string][]byte{
+		"v1": buildTestSffV1(testSprite{w: 20, h: 20, pix: pix}),
+		"v2": buildTestSffV2([][]uint32{testPalette(0)}, testSprite{w: 20, h: 20, pix: pix, format: 4}),
+	} {
+		sff := openTestSff(t, data)
+		for i := 0; i < 2; i++ {
+			if img := decodeTestSprite(t, sff, 0, 0, 20, 20); !bytes.Equal(img.Pix, pix) {
+				t.Errorf("%v: decode %v: pixels differ", name, i+1)
+			}
+		}
+	}
+}
+
+// Every v2 format is extracted, raw sprites included
+func TestExtractV2(t *testing.T) {
+	pix := testPixels(23, 7, 32)
+	var sprites []testSprite
+	for i, format := range []byte{0, 2, 3, 4} {
+		sprites = append(sprites, testSprite{number: int16(i), w: 23, h: 7, pix: pix, format: format})
+	}
+	sff, _ := extractTestSff(t, buildTestSffV2([][]uint32{testPalette(0)}, sprites...))
+	for _, s := range sprites {
+		f, err := os.Open(sff.spriteFilename(sff.GetSprite(0, s.number)))
+		if err != nil {
+			t.Fatalf("format %v: %v", s.format, err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, ok := img.(*image.Paletted); !ok || !bytes.Equal(p.Pix, pix) {
+			t.Errorf("format %v: pixels differ", s.format)
+		}
+	}
+}
+
+// -scale enlarges the size and offset of a sprite, unless they would not fit in the sff fields any more
+func TestScaleOverflow(t *testing.T) {
+	setOption(t, &optScale, 8)
+	for _, tc := range []struct {
+		w      int
+		offset [2]int16
+		ok     bool
+	}{
+		{4, [2]int16{4095, -4096}, true},
+		{8191, [2]int16{0, 0}, true},
+		{4, [2]int16{4096, 0}, false},
+		{4, [2]int16{0, -4097}, false},
+		{8192, [2]int16{0, 0}, false},
+	} {
+		s := testDecoder(tc.w, 1)
+		s.Offset = tc.offset
+		img, err := s.scale(image.NewPaletted(image.Rect(0, 0, tc.w, 1), color.Palette{color.Black}))
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("width %v, offset %v: got size %v, offset %v, want an error", tc.w, tc.offset, s.Size, s.Offset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("width %v, offset %v: %v", tc.w, tc.offset, err)
+		} else if want := [2]int16{tc.offset[0] * 8, tc.offset[1] * 8}; s.Offset != want || img.Bounds().Dx() != 8*tc.w || int(s.Size[0]) != 8*tc.w {
+			t.Errorf("width %v, offset %v: got width %v, size %v, offset %v", tc.w, tc.offset, img.Bounds().Dx(), s.Size, s.Offset)
+		}
+	}
+}
+
+func TestGroupNo(t *testing.T) {
+	for _, tc := range []struct {
+		v                int16
+		signed, unsigned string
+	}{
+		{0, "0", "0"},
+		{32767, "32767", "32767"},
+		{-32768, "-32768", "32768"},
+		{-1, "-1", "65535"},
+	} {
+		setOption(t, &optUnsignedGroups, false)
+		if got := groupNo(tc.v); got != tc.signed {
+			t.Errorf("groupNo(%v): got %v, want %v", tc.v, got, tc.signed)
+		}
+		optUnsignedGroups = true
+		if got := groupNo(tc.v); got != tc.unsigned {
+			t.Errorf("groupNo(%v) with -unsigned-groups: got %v, want %v", tc.v, got, tc.unsigned)
+		}
+	}
+}
+
+// Groups above 32767 are named as stored with -unsigned-groups
+func TestUnsignedGroupFilenames(t *testing.T) {
+	setOption(t, &optUnsignedGroups, true)
+	pix := testPixels(4, 4, 32)
+	sff, outbase := extractTestSff(t, buildTestSffV2([][]uint32{testPalette(0)},
+		testSprite{group: 32767, number: 0, w: 4, h: 4, pix: pix, format: 2},
+		testSprite{group: -32768, number: 1, w: 4, h: 4, pix: pix, format: 2},
+		testSprite{group: -1, number: -1, w: 4, h: 4, pix: pix, format: 2},
+	))
+	if sff.GetSprite(-32768, 1) == nil {
+		t.Fatal("group 32768 is not read as -32768")
+	}
+	for _, name := range []string{"32767 0", "32768 1", "65535 65535"} {
+		if _, err := os.Stat(outbase + " " + name + ".png"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// testPNG returns a 3x2 true-color PNG
+func testPNG(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 10)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEmbeddedPNG(t *testing.T) {
+	stream := testPNG(t)
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"size prefix", append([]byte{1, 2, 3, 4}, stream...)},
+		{"misaligned", append([]byte{1, 2, 3, 4, 5, 6, 7}, stream...)},
+		{"no prefix", stream},
+		{"trailing bytes", append(append([]byte{1, 2, 3, 4}, stream...), 0, 0, 0)},
+	} {
+		got, err := embeddedPNG(tc.data)
+		if err != nil {
+			t.Errorf("%v: %v", tc.name, err)
+		} else if !bytes.Equal(got, stream) {
+			t.Errorf("%v: got %v bytes, want the %v bytes of the PNG", tc.name, len(got), len(stream))
+		}
+	}
+	if _, err := embeddedPNG(make([]byte, 100)); err == nil {
+		t.Error("no error without PNG signature")
+	}
+}
+
+// A PNG sprite whose stream does not start after the 4-byte size is still decoded
+func TestDecodeMisalignedPNG(t *testing.T) {
+	data := append([]byte{0, 0, 0, 0, 0, 0}, testPNG(t)...)
+	sff := openTestSff(t, buildTestSffV2([][]uint32{testPalette(0)},
+		testSprite{w: 3, h: 2, format: 11, data: data}))
+	img, err := sff.GetSprite(0, 0).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := color.NRGBAModel.Convert(img.At(2, 1)).(color.NRGBA), (color.NRGBA{200, 210, 220, 230}); got != want {
+		t.Errorf("pixel 2,1: got %v, want %v", got, want)
+	}
+}
+
+// testPcxHeader returns a 128-byte 8-bit PCX header with the rect x0,y0-x1,y1
+func testPcxHeader(x0, y0, x1, y1, bpl uint16) []byte {
+	h := pcxEncode(nil, 0, 0)
+	binary.LittleEndian.PutUint16(h[4:], x0)
+	binary.LittleEndian.PutUint16(h[6:], y0)
+	binary.LittleEndian.PutUint16(h[8:], x1)
+	binary.LittleEndian.PutUint16(h[10:], y1)
+	binary.LittleEndian.PutUint16(h[66:], bpl)
+	return h
+}
+
+func TestReadPcxHeader(t *testing.T) {
+	s := newSprite()
+	if err := s.readPcxHeader(bytes.NewReader(testPcxHeader(10, 20, 49, 29, 40)), 0); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size != [2]uint16{40, 10} || s.rle != 40 {
+		t.Errorf("got size %v, rle %v, want [40 10], 40", s.Size, s.rle)
+	}
+	bpp4 := testPcxHeader(0, 0, 9, 9, 10)
+	bpp4[3] = 4
+	for name, h := range map[string][]byte{
+		"x1 < x0":        testPcxHeader(10, 0, 9, 9, 10),
+		"y1 < y0":        testPcxHeader(0, 10, 9, 9, 10),
+		"too wide":       testPcxHeader(0, 0, 65535, 0, 65535),
+		"too high":       testPcxHeader(0, 0, 0, 65535, 1),
+		"short line":     testPcxHeader(0, 0, 99, 0, 50),
+		"4 bpp":          bpp4,
+		"cut header":     testPcxHeader(0, 0, 9, 9, 10)[:40],
+		"no header at 0": nil,
+	} {
+		if err := newSprite().readPcxHeader(bytes.NewReader(h), 0); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
+
+// Garbage headers are rejected or give a size within -max-dim
+func FuzzReadPcxHeader(f *testing.F) {
+	f.Add(testPcxHeader(0, 0, 9, 9, 10))
+	f.Add(testPcxHeader(10, 0, 9, 9, 10))
+	f.Add(testPcxHeader(0, 0, 65535, 65535, 65535))
+	f.Fuzz(func(t *testing.T, h []byte) {
+		s := newSprite()
+		if err := s.readPcxHeader(bytes.NewReader(h), 0); err != nil {
+			return
+		}
+		if s.Size[0] == 0 || s.Size[1] == 0 || int(s.Size[0]) > optMaxDim || int(s.Size[1]) > optMaxDim {
+			t.Errorf("accepted size %v", s.Size)
+		}
+	})
+}
+
+func TestPcxPaletteOffset(t *testing.T) {
+	pcx := pcxEncode(testPixels(8, 8, 256), 8, 8)
+	sprite := append(append(append([]byte{}, pcx...), 0x0c), make([]byte, 768)...)
+	size := uint32(len(sprite))
+	padded := append(append([]byte{}, sprite...), make([]byte, 16)...)
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		sizes  []uint32
+		offset int64
+		found  bool
+	}{
+		{"palette at the end", sprite, []uint32{size}, int64(size) - 768, true},
+		{"padding after the palette", padded, []uint32{size + 16, size}, int64(size) - 768, true},
+		{"no palette", pcx, []uint32{uint32(len(pcx))}, int64(len(pcx)) - 768, false},
+	} {
+		offset, found := pcxPaletteOffset(bytes.NewReader(tc.data), 0, tc.sizes...)
+		if offset != tc.offset || found != tc.found {
+			t.Errorf("%v: got %v, %v, want %v, %v", tc.name, offset, found, tc.offset, tc.found)
+		}
+	}
+}
+
+// Every v1 sprite with its own palette is drawn with it, a sprite with the same palette flag with the previous one
+func TestV1Palettes(t *testing.T) {
+	pix := testPixels(8, 8, 256)
+	sff := openTestSff(t, buildTestSffV1(
+		testSprite{group: 0, number: 0, w: 8, h: 8, pix: pix, pal: testPalette(10)},
+		testSprite{group: 1, number: 0, w: 8, h: 8, pix: pix, pal: testPalette(20)},
+		testSprite{group: 1, number: 1, w: 8, h: 8, pix: pix, samePal: true},
+	))
+	for _, tc := range []struct {
+		number int16
+		seed   uint32
+	}{{0, 20}, {1, 20}} {
+		img := decodeTestSprite(t, sff, 1, tc.number, 8, 8)
+		if _, g, _, _ := img.Palette[1].RGBA(); g>>8 != tc.seed {
+			t.Errorf("sprite 1,%v: got palette with green %v, want %v", tc.number, g>>8, tc.seed)
+		}
+	}
+}
+
+// Offsets near 0xFFFFFFFF must not wrap around or be used as sizes
+func TestOffsetsNear4GB(t *testing.T) {
+	pix := testPixels(4, 4, 32)
+	data := buildTestSffV1(testSprite{w: 4, h: 4, pix: pix}, testSprite{number: 1, w: 4, h: 4, pix: pix})
+	binary.LittleEndian.PutUint32(data[32:], 0xffffffff) // next subheader of sprite 0,0
+	sff := openTestSff(t, data)
+	if len(sff.spriteList) != 1 {
+		t.Errorf("v1: got %v sprites, want the 1 before the offset outside the file", len(sff.spriteList))
+	}
+	if img := decodeTestSprite(t, sff, 0, 0, 4, 4); !bytes.Equal(img.Pix, pix) {
+		t.Error("v1: pixels differ")
+	}
+
+	header := make([]byte, 28)
+	binary.LittleEndian.PutUint32(header[16:], 0xfffffff0)
+	var ofs, size uint32
+	var link uint16
+	if err := newSprite().readHeaderV2(bytes.NewReader(header), &ofs, &size, 0x0f, 0, &link); err != nil || ofs != 0xffffffff {
+		t.Errorf("v2: got offset %#x, error %v, want 0xffffffff", ofs, err)
+	}
+	if err := newSprite().readHeaderV2(bytes.NewReader(header), &ofs, &size, 0x10, 0, &link); err == nil {
+		t.Error("v2: no error for a data offset past 4GB")
+	}
+	data = buildTestSffV2([][]uint32{testPalette(0)}, testSprite{w: 4, h: 4, pix: pix, format: 2})
+	binary.LittleEndian.PutUint32(data[64+16:], 0xfffffff0)
+	if sff := openTestSff(t, data); len(sff.spriteList) != 0 {
+		t.Errorf("v2: got %v sprites, want none", len(sff.spriteList))
+	}
+}
+
+// The alpha of the entries of a v2.01 palette is kept in the PNG, for decoded sprites and embedded PNG8 ones
+func TestTranslucentPalette(t *testing.T) {
+	pal := testPalette(0)
+	pal[1] = pal[1]&0xffffff | 64<<24
+	pal[2] = pal[2]&0xffffff | 128<<24
+	if got := paletteAlpha(pal); !bytes.Equal(got, []byte{0, 64, 128}) {
+		t.Errorf("paletteAlpha: got %v, want [0 64 128]", got)
+	}
+	pix := []byte{0, 1, 2, 3}
+	png8 := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White, color.White, color.White})
+	copy(png8.Pix, pix)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, png8); err != nil {
+		t.Fatal(err)
+	}
+	sff, _ := extractTestSff(t, buildTestSffV2([][]uint32{pal},
+		testSprite{group: 0, w: 2, h: 2, pix: pix, format: 2},
+		testSprite{group: 1, w: 2, h: 2, format: 10, data: append([]byte{0, 0, 0, 0}, buf.Bytes()...)},
+	))
+	for _, g := range []int16{0, 1} {
+		f, err := os.Open(sff.spriteFilename(sff.GetSprite(g, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range pix {
+			want := color.NRGBA{byte(pal[c]), byte(pal[c] >> 8), byte(pal[c] >> 16), byte(pal[c] >> 24)}
+			got := color.NRGBAModel.Convert(img.At(i%2, i/2)).(color.NRGBA)
+			if want.A == 0 {
+				got.R, got.G, got.B, want.R, want.G, want.B = 0, 0, 0, 0, 0, 0
+			}
+			if got != want {
+				t.Errorf("sprite %v,0 pixel %v: got %v, want %v", g, i, got, want)
+			}
+		}
+	}
+}
+
+// SFF v1 and v2 sprites are saved under the same names
+func TestSpriteFilenamesV1V2(t *testing.T) {
+	pix := testPixels(4, 4, 32)
+	pngNames := func(data []byte) []string {
+		_, outbase := extractTestSff(t, data)
+		names, err := filepath.Glob(outbase + "*.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range names {
+			names[i] = filepath.Base(name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	v1 := pngNames(buildTestSffV1(
+		testSprite{group: 0, number: 0, w: 4, h: 4, pix: pix},
+		testSprite{group: 5, number: 3, w: 4, h: 4, pix: pix},
+	))
+	v2 := pngNames(buildTestSffV2([][]uint32{testPalette(0)},
+		testSprite{group: 0, number: 0, w: 4, h: 4, pix: pix, format: 2},
+		testSprite{group: 5, number: 3, w: 4, h: 4, pix: pix, format: 2},
+	))
+	want := []string{"test 0 0.png", "test 5 3.png"}
+	if fmt.Sprint(v1) != fmt.Sprint(want) || fmt.Sprint(v2) != fmt.Sprint(want) {
+		t.Errorf("got v1 %q, v2 %q, want %q for both", v1, v2, want)
+	}
+}
+
+// A palette of 64 colors is padded to 256 with transparent black
+func TestPalette64(t *testing.T) {
+	pal := testPalette(7)[:64]
+	norm := normalizePalette(pal)
+	if len(norm) != 256 || norm[63] != pal[63] || norm[64] != 0 || norm[255] != 0 {
+		t.Errorf("normalizePalette: got %v colors, 63: %08x, 64: %08x", len(norm), norm[63], norm[64])
+	}
+	if p := genPalette(pal); len(p) != 256 || p[100] != (color.NRGBA{}) {
+		t.Errorf("genPalette: got %v colors, 100: %v", len(p), p[100])
+	}
+	pix := []byte{1, 63, 64, 200}
+	sff := openTestSff(t, buildTestSffV2([][]uint32{pal}, testSprite{w: 2, h: 2, pix: pix, format: 2}))
+	img := decodeTestSprite(t, sff, 0, 0, 2, 2)
+	for i, want := range []color.Color{color.NRGBA{1, 7, 254, 255}, color.NRGBA{63, 7, 192, 255}, color.NRGBA{}, color.NRGBA{}} {
+		if got := img.At(i%2, i/2); got != want {
+			t.Errorf("pixel %v (index %v): got %v, want %v", i, pix[i], got, want)
+		}
+	}
+}
+
+// A sprite with a palette index past the palettes of the file is drawn with palette 0, or is an error with -strict
+func TestMissingPalette(t *testing.T) {
+	pix := testPixels(4, 4, 32)
+	data := buildTestSffV2([][]uint32{testPalette(3)}, testSprite{w: 4, h: 4, pix: pix, format: 2, palidx: 5})
+	sff := openTestSff(t, data)
+	if s := sff.GetSprite(0, 0); s.palidx != 0 {
+		t.Errorf("got palette %v, want 0", s.palidx)
+	}
+	if img := decodeTestSprite(t, sff, 0, 0, 4, 4); img.Palette[1] != (color.NRGBA{1, 3, 254, 255}) {
+		t.Errorf("got color 1 %v, want the one of palette 0", img.Palette[1])
+	}
+	setOption(t, &optStrict, true)
+	if _, err := loadSff(context.Background(), bytes.NewReader(data), "test.sff", false, true); err == nil {
+		t.Error("no error with -strict")
+	}
+}
+
+// A v1 sprite flagged with the same palette that stores one anyway uses it only with -v1-palette-at-end
+func TestV1PaletteAtEnd(t *testing.T) {
+	pix := testPixels(4, 4, 32)
+	data := buildTestSffV1(
+		testSprite{group: 0, number: 0, w: 4, h: 4, pix: pix, pal: testPalette(10)},
+		testSprite{group: 1, number: 0, w: 4, h: 4, pix: pix, pal: testPalette(20)},
+		testSprite{group: 1, number: 1, w: 4, h: 4, pix: pix, pal: testPalette(30), samePal: true},
+	)
+	for _, tc := range []struct {
+		palAtEnd    bool
+		seed        uint32
+		numPalAtEnd int
+	}{{false, 20, 1}, {true, 30, 0}} {
+		setOption(t, &optV1PalAtEnd, tc.palAtEnd)
+		sff := openTestSff(t, data)
+		if sff.numPalAtEnd != tc.numPalAtEnd {
+			t.Errorf("-v1-palette-at-end %v: got %v sprites with a palette at the end, want %v", tc.palAtEnd, sff.numPalAtEnd, tc.numPalAtEnd)
+		}
+		img := decodeTestSprite(t, sff, 1, 1, 4, 4)
+		if _, g, _, _ := img.Palette[1].RGBA(); g>>8 != tc.seed {
+			t.Errorf("-v1-palette-at-end %v: got palette with green %v, want %v", tc.palAtEnd, g>>8, tc.seed)
+		}
+	}
+}
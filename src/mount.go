@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// mountDirs are the directories mounted at the root of physfs, the current directory first and then
+// every -mount in order. A file found in more than one of them is read from the first.
+var mountDirs []string
+
+// parseMountOptions reads -mount and -writedir from args and returns the write directory.
+// They are read before the other options, since the sff files named on the command line are opened through the mounts.
+// -writedir is also where the output files go unless -o is given.
+func parseMountOptions(args []string) (string, error) {
+	currentDir, _ := os.Getwd()
+	mountDirs = []string{currentDir}
+	writeDir := currentDir
+	for i := 0; i < len(args); i++ {
+		if args[i] != "-mount" && args[i] != "-writedir" {
+			continue
+		}
+		if i+1 >= len(args) {
+			return "", fmt.Errorf("Error: %v requires a directory", args[i])
+		}
+		dir, err := filepath.Abs(args[i+1])
+		if err != nil {
+			return "", fmt.Errorf("Error: %v %v: %v", args[i], args[i+1], err)
+		}
+		if args[i] == "-mount" {
+			mountDirs = append(mountDirs, dir)
+		} else {
+			writeDir = dir
+			optOutputDir = dir
+		}
+		i++
+	}
+	return writeDir, nil
+}
+
+// realPath returns the path on the real file system of file, a path in the mounted physfs
+func realPath(file string) string {
+	for _, dir := range mountDirs {
+		path := filepath.Join(dir, file)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return file
+}
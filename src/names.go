@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/leonkasovan/sffcli/packages/physfs"
+)
+
+/*
+loadSpriteNames reads the group,number,name rows of a -names csv file. A row with an empty number
+names every sprite of the group that has no row of its own, e.g.
+
+	group,number,name
+	0,,stand
+	181,0,win pose
+	9000,1,big portrait
+
+A first row that does not start with a number is taken as a header. Lines starting with # are comments.
+*/
+func loadSpriteNames(filename string) (map[[2]int16]string, map[int16]string, error) {
+	data, err := physfs.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading %v: %v", filename, err)
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+	names := make(map[[2]int16]string)
+	groups := make(map[int16]string)
+	for first := true; ; first = false {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("Error reading %v: %v", filename, err)
+		}
+		line, _ := r.FieldPos(0)
+		g, err := strconv.ParseInt(strings.TrimSpace(row[0]), 10, 32)
+		if err != nil && first {
+			continue // header
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%v line %v: invalid group %v", filename, line, row[0])
+		}
+		name := sanitizeName(row[2])
+		if name == "" {
+			continue
+		}
+		if ns := strings.TrimSpace(row[1]); ns == "" {
+			groups[int16(g)] = name
+		} else if n, err := strconv.ParseInt(ns, 10, 32); err == nil {
+			names[[...]int16{int16(g), int16(n)}] = name
+		} else {
+			return nil, nil, fmt.Errorf("%v line %v: invalid number %v", filename, line, row[1])
+		}
+	}
+	return names, groups, nil
+}
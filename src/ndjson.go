@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// ndjsonWriter receives one JSON object per line for every sprite as it is read, when -ndjson is used.
+// The lines of an sff are in file order, with -jf the lines of different sff files interleave and
+// tell their file by the "sff" field.
+var ndjsonWriter io.Writer
+
+var ndjsonMutex sync.Mutex
+
+type ndjsonSprite struct {
+	Sff      string      `json:"sff"`
+	Index    int         `json:"index"`
+	Group    json.Number `json:"group"`
+	Number   json.Number `json:"number"`
+	Width    uint16      `json:"width"`
+	Height   uint16      `json:"height"`
+	XOffset  int16       `json:"xoffset"`
+	YOffset  int16       `json:"yoffset"`
+	Coldepth byte        `json:"coldepth"`
+	Format   string      `json:"format"`
+	Palidx   int         `json:"palidx"`
+	Filename string      `json:"filename,omitempty"`
+}
+
+// writeSpriteNDJSON writes the line of sprite s, see spriteFormatAndFile for size and empty
+func writeSpriteNDJSON(sff *Sff, s *Sprite, size uint32, empty bool) error {
+	format, filename := spriteFormatAndFile(sff, s, size, empty)
+	line, err := json.Marshal(ndjsonSprite{sff.filename, s.index, json.Number(groupNo(s.Group)), json.Number(groupNo(s.Number)),
+		s.Size[0], s.Size[1], s.Offset[0], s.Offset[1], s.coldepth, format, s.palidx, filename})
+	if err != nil {
+		return err
+	}
+	ndjsonMutex.Lock()
+	defer ndjsonMutex.Unlock()
+	_, err = ndjsonWriter.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// offsetsWriter receives one [group,number] section with the axis and size of every saved sprite when -offsets is used
+var offsetsWriter io.Writer
+
+func writeSpriteOffsets(s *Sprite) {
+	fmt.Fprintf(offsetsWriter, "[%v,%v]\nx = %v\ny = %v\nw = %v\nh = %v\n\n",
+		groupNo(s.Group), groupNo(s.Number), s.Offset[0], s.Offset[1], s.Size[0], s.Size[1])
+}
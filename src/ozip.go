@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// zipOutput receives the sprite images, palettes and TSV files instead of the file system when -ozip is used.
+// Entries are added in extraction order, the TSV files last sorted by name, so the same input gives the same archive.
+var zipOutput *zip.Writer
+
+// zipPath is the filename given to -ozip
+var zipPath string
+
+var (
+	zipEntries = make(map[string]bool)          // names of the entries written to zipOutput
+	zipTsv     = make(map[string]*bytes.Buffer) // TSV files by name, rows are appended until the archive is closed
+)
+
+// outputFile is an output file on disk, or with -ozip an entry of the zip archive
+type outputFile struct {
+	w    io.Writer
+	f    *os.File
+	size int64 // bytes written
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.size += int64(n)
+	return n, err
+}
+
+func (o *outputFile) Close() error {
+	if o.f != nil {
+		return o.f.Close()
+	}
+	return nil
+}
+
+// zipName returns the archive entry name of the output file filename
+func zipName(filename string) string {
+	return strings.TrimLeft(filepath.ToSlash(filepath.Clean(filename)), "/")
+}
+
+// createOutput creates the output file filename, with -ozip as the next entry of the archive.
+// A zip entry is complete when the next one is created, so only one output file can be open at a time.
+func createOutput(filename string) (*outputFile, error) {
+	if zipOutput == nil {
+		f, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{w: f, f: f}, nil
+	}
+	name := zipName(filename)
+	w, err := zipOutput.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	zipEntries[name] = true
+	return &outputFile{w: w}, nil
+}
+
+// namedOutput returns the path of an output file named on the command line, below -o unless it is absolute
+func namedOutput(filename string) string {
+	if optOutputDir == "" || filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(optOutputDir, filename)
+}
+
+// createOutputDir is createOutput creating the directory of filename first when it is written to disk
+func createOutputDir(filename string) (*outputFile, error) {
+	if zipOutput == nil {
+		if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	return createOutput(filename)
+}
+
+// writeOutput writes data to the output file filename, like os.WriteFile
+func writeOutput(filename string, data []byte) error {
+	fo, err := createOutput(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := fo.Write(data); err != nil {
+		fo.Close()
+		return err
+	}
+	return fo.Close()
+}
+
+// outputExists reports whether the output file filename exists, with -ozip whether it was added to the archive
+func outputExists(filename string) bool {
+	if zipOutput != nil {
+		return zipEntries[zipName(filename)] || zipTsv[zipName(filename)] != nil
+	}
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// closeZip adds the TSV files to the -ozip archive and completes it
+func closeZip() error {
+	names := make([]string, 0, len(zipTsv))
+	for name := range zipTsv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := zipOutput.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(zipTsv[name].Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := zipOutput.Close(); err != nil {
+		return fmt.Errorf("Error writing zip: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+type combinedPal struct {
+	group, number int16
+	pal           []uint32
+}
+
+// combinedPals collects the unique palettes of every sff when -pal-combined is used
+var combinedPals []combinedPal
+
+// addCombinedPalette keeps pal for the combined palette file unless an identical palette is already kept
+func addCombinedPalette(group, number int16, pal []uint32) {
+	for _, c := range combinedPals {
+		if slices.Equal(c.pal, pal) {
+			return
+		}
+	}
+	combinedPals = append(combinedPals, combinedPal{group, number, slices.Clone(pal)})
+}
+
+/*
+writeCombinedPalettes writes all collected palettes into one file:
+
+	"SPAL"                    magic
+	uint16                    number of palettes N
+	N x (int16, int16)        group,number of each palette
+	N x 256 x (R, G, B)       the palettes, each one laid out like an ACT file
+
+All values are little endian, so a palette editor can load bank i at offset 6+4*N+768*i.
+*/
+func writeCombinedPalettes(filename string) error {
+	if len(combinedPals) == 0 {
+		return fmt.Errorf("No palette for combined palette file %v", filename)
+	}
+	if len(combinedPals) > 0xffff {
+		return fmt.Errorf("Too many palettes for combined palette file %v: %v", filename, len(combinedPals))
+	}
+	if skipWrite(filename, 6+len(combinedPals)*(4+768)) {
+		return nil
+	}
+	fo, err := createOutputDir(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	bw := bufio.NewWriter(fo)
+	bw.WriteString("SPAL")
+	binary.Write(bw, binary.LittleEndian, uint16(len(combinedPals)))
+	for _, c := range combinedPals {
+		binary.Write(bw, binary.LittleEndian, [2]int16{c.group, c.number})
+	}
+	for _, c := range combinedPals {
+		for i := 0; i < 256; i++ {
+			var col uint32
+			if i < len(c.pal) {
+				col = c.pal[i]
+			}
+			bw.Write([]byte{uint8(col), uint8(col >> 8), uint8(col >> 16)})
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("Error writing file %v: %v", filename, err)
+	}
+	fmt.Printf("Combined palette file %v created with %v palettes\n", filename, len(combinedPals))
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+)
+
+// writePalettePNG writes pal as a 16x16 indexed PNG whose pixel x,y has index y*16+x, so its PLTE
+// chunk is the palette, for -palfmt png. Index 0 and translucent entries are kept in tRNS.
+// It returns the size of the file, 0 when the file is skipped.
+func writePalettePNG(pal []uint32, filename string) (int64, error) {
+	img := image.NewPaletted(image.Rect(0, 0, 16, 16), genPalette(pal))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	if skipWrite(filename, 16*16+3*256) {
+		return 0, nil
+	}
+	fo, err := createOutput(filename)
+	if err != nil {
+		return 0, fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	if err := png.Encode(fo, img); err != nil {
+		return 0, fmt.Errorf("Error writing file %v: %v", filename, err)
+	}
+	return fo.size, nil
+}
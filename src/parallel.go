@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// memBudget limits the bytes of decoded sprites held at the same time by the files extracted with -jf,
+// nil unless -mem-budget is given
+var memBudget *budget
+
+// budget is a semaphore weighted by bytes
+type budget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int64
+	used int64
+}
+
+func newBudget(size int64) *budget {
+	b := &budget{size: size}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until n bytes are free and returns the bytes taken, to pass to release.
+// A sprite larger than the whole budget waits for every other one to be done and then runs alone.
+func (b *budget) acquire(n int64) int64 {
+	if b == nil {
+		return 0
+	}
+	n = min(n, b.size)
+	b.mu.Lock()
+	for b.used+n > b.size {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+	return n
+}
+
+func (b *budget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// decodedSize returns the bytes of the decoded pixels of s, 4 per pixel for a true-color sprite
+func (s *Sprite) decodedSize() int64 {
+	n := int64(s.Size[0]) * int64(s.Size[1])
+	if s.coldepth > 8 {
+		n *= 4
+	}
+	return n
+}
+
+// sequentialOption returns the option whose output needs the sff files one at a time, in order,
+// or "" when files can be extracted concurrently with -jf
+func sequentialOption() string {
+	switch {
+	case optContactSheet != "":
+		return "-contact-sheet"
+	case optSingle != "":
+		return "-single"
+	case optPalCombined != "":
+		return "-pal-combined"
+	case optStats:
+		return "-stats"
+	case optBestFormat:
+		return "-best-format"
+	case optDryRun:
+		return "-dry-run"
+	case hashWriter != nil:
+		return "-hashes"
+	case timingWriter != nil:
+		return "-timings"
+	case csvWriter != nil:
+		return "-csv"
+	case offsetsWriter != nil:
+		return "-offsets"
+	case zipOutput != nil:
+		return "-ozip"
+	}
+	return ""
+}
+
+// extractFiles extracts the sff files found in the current directory, -jf files at a time,
+// by default as many as there are CPUs
+func extractFiles(files []string, cmdSavePalette bool) {
+	jobs := optFileJobs
+	if opt := sequentialOption(); opt != "" {
+		if jobs > 1 {
+			fmt.Printf("Warning: -jf ignored, %v needs the sff files one at a time\n", opt)
+		}
+		jobs = 1
+	} else if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs <= 1 {
+		for _, file := range files {
+			if interrupted.Load() {
+				break
+			}
+			sff, err := extractSff(file, cmdSavePalette)
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				printSummary(sff)
+			}
+		}
+		return
+	}
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, file := range files {
+		sem <- struct{}{}
+		if interrupted.Load() {
+			break
+		}
+		wg.Add(1)
+		go func(file string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// physfs keeps global state, concurrent extractions read the real file system instead
+			f, err := os.Open(realPath(file))
+			if err != nil {
+				fmt.Printf("File not found: %v\n", file)
+				return
+			}
+			defer f.Close()
+			sff, err := extractSffReader(f, file, cmdSavePalette)
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				printSummary(sff)
+			}
+		}(file)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	b := newBudget(10)
+	n := b.acquire(6)
+	acquired := make(chan int64)
+	go func() { acquired <- b.acquire(6) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired 6 of 10 bytes while 6 are used")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.release(n)
+	b.release(<-acquired)
+	if n := b.acquire(100); n != 10 {
+		t.Errorf("got %v bytes for a sprite larger than the budget, want 10", n)
+	}
+	var none *budget
+	none.release(none.acquire(100))
+}
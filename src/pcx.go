@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// savePCX writes v1 sprite s as a PCX file next to its image, for -keep-pcx. The file is the
+// size bytes of the sff at offset, the PCX as stored, followed by the 0x0C marker and the
+// 256-color palette pal unless pal is nil.
+func savePCX(f io.ReadSeeker, offset, size int64, sff *Sff, s *Sprite, pal []uint32) error {
+	filename := strings.TrimSuffix(sff.spriteFilename(s), "."+optFormat) + ".pcx"
+	data := make([]byte, size, int(size)+1+3*len(pal))
+	if skipWrite(filename, cap(data)) {
+		return nil
+	}
+	f.Seek(offset, 0)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return err
+	}
+	if pal != nil {
+		data = append(data, 0x0c)
+		for _, c := range pal {
+			data = append(data, uint8(c), uint8(c>>8), uint8(c>>16))
+		}
+	}
+	if err := writeOutput(filename, data); err != nil {
+		return fmt.Errorf("Error writing file %v: %v", filename, err)
+	}
+	return nil
+}
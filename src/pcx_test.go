@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// -keep-pcx writes the PCX of every sprite as stored in the sff, with the palette it is drawn
+// with when it stores none, whatever -uniform-pal says
+func TestKeepPCX(t *testing.T) {
+	pcx := func(s testSprite, pal []uint32) []byte {
+		data := append(pcxEncode(s.pix, s.w, s.h), 0x0c)
+		for _, c := range pal {
+			data = append(data, byte(c), byte(c>>8), byte(c>>16))
+		}
+		return data
+	}
+	sprites := []testSprite{
+		{number: 0, w: 8, h: 8, pix: testPixels(8, 8, 256), pal: testPalette(1)},
+		{number: 1, w: 5, h: 3, pix: testPixels(5, 3, 256), samePal: true},
+		{number: 2, w: 6, h: 2, pix: testPixels(6, 2, 256), samePal: true, pal: testPalette(3)},
+		{number: 3, w: 7, h: 4, pix: testPixels(7, 4, 256), pal: testPalette(2)},
+	}
+	want := [][]byte{
+		pcx(sprites[0], testPalette(1)),
+		pcx(sprites[1], testPalette(1)),
+		pcx(sprites[2], testPalette(3)),
+		pcx(sprites[3], testPalette(2)),
+	}
+	for _, uniform := range []bool{false, true} {
+		setOption(t, &optKeepPCX, true)
+		setOption(t, &optUniformPal, uniform)
+		sff, _ := extractTestSff(t, buildTestSffV1(sprites...))
+		for i, s := range sprites {
+			filename := strings.TrimSuffix(sff.spriteFilename(sff.GetSprite(0, s.number)), "."+optFormat) + ".pcx"
+			got, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want[i]) {
+				t.Errorf("uniform %v, sprite %v: got %v bytes, want %v bytes as stored", uniform, i, len(got), len(want[i]))
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+)
+
+// writePortraits draws the small (9000,0) and large (9000,1) portraits of an sff side by side,
+// top aligned, into the PNG filename. A missing portrait is left out with a warning.
+func writePortraits(filename, sffName string) error {
+	sff, err := OpenSff(sffName)
+	if err != nil {
+		return err
+	}
+	var imgs []image.Image
+	for _, n := range []int16{0, 1} {
+		s := sff.GetSprite(9000, n)
+		if s == nil {
+			fmt.Printf("Warning: portrait 9000,%v not found in %v\n", n, sffName)
+			continue
+		}
+		img, err := s.Decode()
+		if err != nil {
+			return fmt.Errorf("Portrait 9000,%v of %v: %v", n, sffName, err)
+		}
+		imgs = append(imgs, img)
+	}
+	if len(imgs) == 0 {
+		return fmt.Errorf("No portrait 9000,0 or 9000,1 in %v", sffName)
+	}
+	w, h := 0, 0
+	for _, img := range imgs {
+		w += img.Bounds().Dx()
+		h = max(h, img.Bounds().Dy())
+	}
+	// Each sprite is drawn with its own palette, so the sheet is true color
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	x := 0
+	for _, img := range imgs {
+		b := img.Bounds()
+		draw.Draw(out, image.Rect(x, 0, x+b.Dx(), b.Dy()), img, b.Min, draw.Src)
+		x += b.Dx()
+	}
+	if skipWrite(filename, w*h*4) {
+		return nil
+	}
+	fo, err := createOutputDir(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	if err := png.Encode(fo, out); err != nil {
+		return err
+	}
+	fmt.Printf("Portraits of %v saved to %v (%vx%v)\n", sffName, filename, w, h)
+	return nil
+}
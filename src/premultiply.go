@@ -0,0 +1,47 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// straightColor returns c with straight alpha. The color.NRGBA entries of genPalette
+// are returned as they are, so a transparent entry keeps its RGB.
+func straightColor(c color.Color) color.NRGBA {
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+func premultiplyColor(c color.NRGBA) color.RGBA {
+	a := uint32(c.A)
+	return color.RGBA{uint8((uint32(c.R)*a + 127) / 255), uint8((uint32(c.G)*a + 127) / 255), uint8((uint32(c.B)*a + 127) / 255), c.A}
+}
+
+// premultiply returns img as true color with the color channels multiplied by alpha, for -premultiply
+func premultiply(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	if p, ok := img.(*image.Paletted); ok {
+		pal := make([]color.RGBA, 256)
+		for i, c := range p.Palette {
+			pal[i] = premultiplyColor(straightColor(c))
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				out.SetRGBA(x, y, pal[p.ColorIndexAt(x, y)])
+			}
+		}
+		return out
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.SetRGBA(x, y, premultiplyColor(straightColor(img.At(x, y))))
+		}
+	}
+	return out
+}
+
+// premultipliedPixels returns the pixels of img as they are in an NRGBA image. The PNG, TGA and TIFF
+// encoders convert an RGBA image back to straight alpha, they write the channels of an NRGBA image unchanged.
+func premultipliedPixels(img *image.RGBA) *image.NRGBA {
+	return &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}
+}
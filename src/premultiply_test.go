@@ -0,0 +1,22 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPremultiply(t *testing.T) {
+	pal := color.Palette{color.NRGBA{200, 100, 50, 0}, color.NRGBA{200, 100, 50, 128}, color.NRGBA{200, 100, 50, 255}}
+	src := image.NewPaletted(image.Rect(0, 0, 3, 1), pal)
+	copy(src.Pix, []byte{0, 1, 2})
+	img := premultiply(src)
+	for x, want := range []color.RGBA{{0, 0, 0, 0}, {100, 50, 25, 128}, {200, 100, 50, 255}} {
+		if got := img.RGBAAt(x, 0); got != want {
+			t.Errorf("pixel %v: got %v, want %v", x, got, want)
+		}
+	}
+	if got := premultipliedPixels(img).NRGBAAt(1, 0); got != (color.NRGBA{100, 50, 25, 128}) {
+		t.Errorf("premultipliedPixels: got %v, want the premultiplied values", got)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// quantizeImage reduces a true-color image to 256 colors with median cut.
+// Pixels with alpha below 128 map to index 0, which is transparent like in sff palettes,
+// the other pixels are opaque and use indices 1..255. -quantize-quality 1..10 sets how many
+// pixels are sampled to build the palette, 10 uses all of them.
+func quantizeImage(img image.Image) (*image.Paletted, []uint32) {
+	b := img.Bounds()
+	step := 11 - optQuantizeQuality
+	var samples []color.NRGBA
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A >= 128 && n%step == 0 {
+				samples = append(samples, c)
+			}
+			n++
+		}
+	}
+	pal := make([]uint32, 256)
+	colors := medianCut(samples, 255)
+	for i, c := range colors {
+		pal[i+1] = 0xff000000 | uint32(c.B)<<16 | uint32(c.G)<<8 | uint32(c.R)
+	}
+	out := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), genPalette(pal))
+	nearest := make(map[color.NRGBA]uint8)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 || len(colors) == 0 {
+				continue
+			}
+			c.A = 255
+			idx, ok := nearest[c]
+			if !ok {
+				idx = uint8(nearestColor(colors, c) + 1)
+				nearest[c] = idx
+			}
+			out.Pix[out.PixOffset(x-b.Min.X, y-b.Min.Y)] = idx
+		}
+	}
+	return out, pal
+}
+
+// medianCut splits the colors into at most n boxes, halving the box with the widest
+// channel range at its median each time, and returns the average color of every box
+func medianCut(colors []color.NRGBA, n int) []color.NRGBA {
+	if len(colors) == 0 {
+		return nil
+	}
+	boxes := [][]color.NRGBA{colors}
+	for len(boxes) < n {
+		best, bestChannel, bestRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if ch, r := widestChannel(box); r > bestRange {
+				best, bestChannel, bestRange = i, ch, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return channel(box[i], bestChannel) < channel(box[j], bestChannel) })
+		mid := len(box) / 2
+		boxes[best] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+	result := make([]color.NRGBA, len(boxes))
+	for i, box := range boxes {
+		var r, g, b int
+		for _, c := range box {
+			r, g, b = r+int(c.R), g+int(c.G), b+int(c.B)
+		}
+		result[i] = color.NRGBA{uint8(r / len(box)), uint8(g / len(box)), uint8(b / len(box)), 255}
+	}
+	return result
+}
+
+func channel(c color.NRGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// widestChannel returns the channel (0 red, 1 green, 2 blue) with the largest range in box
+func widestChannel(box []color.NRGBA) (int, int) {
+	best, bestRange := 0, 0
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range box {
+			v := channel(c, ch)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if int(hi)-int(lo) > bestRange {
+			best, bestRange = ch, int(hi)-int(lo)
+		}
+	}
+	return best, bestRange
+}
+
+func nearestColor(colors []color.NRGBA, c color.NRGBA) int {
+	best, bestDist := 0, -1
+	for i, p := range colors {
+		dr, dg, db := int(p.R)-int(c.R), int(p.G)-int(c.G), int(p.B)-int(c.B)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// indexImage maps a true-color image to the nearest colors of pal, an sff palette, so it shares
+// the palette of the indexed sprites. Index 0 is left for the pixels with alpha below 128.
+func indexImage(img image.Image, pal []uint32) *image.Paletted {
+	b := img.Bounds()
+	colors := make([]color.NRGBA, 0, len(pal))
+	for _, c := range pal[min(1, len(pal)):] {
+		colors = append(colors, color.NRGBA{uint8(c), uint8(c >> 8), uint8(c >> 16), 255})
+	}
+	out := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), genPalette(pal))
+	nearest := make(map[color.NRGBA]uint8)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 || len(colors) == 0 {
+				continue
+			}
+			c.A = 255
+			idx, ok := nearest[c]
+			if !ok {
+				idx = uint8(nearestColor(colors, c) + 1)
+				nearest[c] = idx
+			}
+			out.Pix[out.PixOffset(x-b.Min.X, y-b.Min.Y)] = idx
+		}
+	}
+	return out
+}
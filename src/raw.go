@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// saveRaw writes the compressed data of v2 sprite s next to its image, for -keep-raw.
+// The extension names the format and a .size file beside it holds the sprite size as WxH.
+func saveRaw(sff *Sff, s *Sprite, data []byte) error {
+	filename := strings.TrimSuffix(sff.spriteFilename(s), "."+optFormat) + "." + strings.ToLower(formatName(-s.rle))
+	if skipWrite(filename, len(data)) {
+		return nil
+	}
+	if err := writeOutput(filename, data); err != nil {
+		return fmt.Errorf("Error writing file %v: %v", filename, err)
+	}
+	if err := writeOutput(filename+".size", []byte(fmt.Sprintf("%vx%v\n", s.Size[0], s.Size[1]))); err != nil {
+		return fmt.Errorf("Error writing file %v: %v", filename+".size", err)
+	}
+	return nil
+}
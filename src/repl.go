@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Commands:
+  list [start-end]  list the sprites with index start <= i <= end
+  show group,number write the sprite to a temporary PNG and open it
+  pal group,number  write palette group,number as a swatch to a temporary PNG and open it
+  help              show this help
+  quit              leave`
+
+// runRepl opens filename once and runs the commands read from stdin
+func runRepl(filename string) error {
+	sff, err := OpenSff(filename)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v: %v sprites, %v palettes\n%v\n", filename, len(sff.spriteList), len(sff.palList.PalTable), replHelp)
+	in := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); in.Scan(); fmt.Print("> ") {
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "":
+		case "list":
+			err = replList(sff, arg)
+		case "show":
+			err = replShow(sff, arg)
+		case "pal":
+			err = replPal(sff, arg)
+		case "help":
+			fmt.Println(replHelp)
+		case "quit", "exit":
+			return nil
+		default:
+			err = fmt.Errorf("Unknown command %v, type help", cmd)
+		}
+		if err != nil {
+			fmt.Println(err)
+			err = nil
+		}
+	}
+	fmt.Println()
+	return in.Err()
+}
+
+// parseGroupNumber parses "group,number"
+func parseGroupNumber(v string) (int16, int16, error) {
+	gs, ns, found := strings.Cut(v, ",")
+	g, err1 := strconv.Atoi(strings.TrimSpace(gs))
+	n, err2 := strconv.Atoi(strings.TrimSpace(ns))
+	if !found || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("Error: expected group,number, got %v", v)
+	}
+	return int16(g), int16(n), nil
+}
+
+func replList(sff *Sff, arg string) error {
+	start, end := 0, len(sff.spriteList)-1
+	if arg != "" {
+		a, b, found := strings.Cut(arg, "-")
+		var err1, err2 error
+		start, err1 = strconv.Atoi(a)
+		end, err2 = start, nil
+		if found {
+			end, err2 = strconv.Atoi(b)
+		}
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("Error: expected start-end, got %v", arg)
+		}
+	}
+	for i := max(start, 0); i <= end && i < len(sff.spriteList); i++ {
+		s := sff.spriteList[i]
+		format := "PCX"
+		if sff.header.Ver0 != 1 {
+			format = formatName(-s.rle)
+		}
+		fmt.Printf("%5v %v,%v %vx%v %v\n", i, groupNo(s.Group), groupNo(s.Number), s.Size[0], s.Size[1], format)
+	}
+	return nil
+}
+
+func replShow(sff *Sff, arg string) error {
+	g, n, err := parseGroupNumber(arg)
+	if err != nil {
+		return err
+	}
+	s := sff.GetSprite(g, n)
+	if s == nil {
+		return fmt.Errorf("Sprite %v,%v not found", groupNo(g), groupNo(n))
+	}
+	img, err := s.Decode()
+	if err != nil {
+		return err
+	}
+	fo, err := os.CreateTemp("", fmt.Sprintf("sffcli %v %v *.png", groupNo(g), groupNo(n)))
+	if err != nil {
+		return err
+	}
+	defer fo.Close()
+	if err := png.Encode(fo, img); err != nil {
+		return err
+	}
+	return openFile(fo.Name())
+}
+
+func replPal(sff *Sff, arg string) error {
+	g, n, err := parseGroupNumber(arg)
+	if err != nil {
+		return err
+	}
+	idx, ok := sff.palList.PalTable[[...]int16{g, n}]
+	if !ok || idx < 0 {
+		return fmt.Errorf("Palette %v,%v not found", groupNo(g), groupNo(n))
+	}
+	actFilename := filepath.Join(os.TempDir(), fmt.Sprintf("sffcli pal %v %v.act", groupNo(g), groupNo(n)))
+	if err := savePaletteSwatch(sff.palList.Get(idx), actFilename); err != nil {
+		return err
+	}
+	return openFile(strings.TrimSuffix(actFilename, ".act") + ".swatch.png")
+}
+
+// openFile shows filename with the default viewer of the system, or prints its name when there is none
+func openFile(filename string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", filename)
+	case "darwin":
+		cmd = exec.Command("open", filename)
+	default:
+		cmd = exec.Command("xdg-open", filename)
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("Saved %v\n", filename)
+		return nil
+	}
+	fmt.Printf("Opened %v\n", filename)
+	return nil
+}
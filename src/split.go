@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseSplit parses -split start:end,start:end,... into inclusive group ranges
+func parseSplit(v string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, part := range strings.Split(v, ",") {
+		first, last, found := strings.Cut(part, ":")
+		start, err1 := strconv.Atoi(strings.TrimSpace(first))
+		end, err2 := strconv.Atoi(strings.TrimSpace(last))
+		if !found || err1 != nil || err2 != nil || end < start {
+			return nil, fmt.Errorf("Error: -split requires start:end group ranges separated by commas, got %v", part)
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
+
+// splitRange returns the first -split range holding group g. Groups above 32767 match
+// both as negative and as unsigned numbers.
+func splitRange(g int16) ([2]int, bool) {
+	for _, r := range optSplit {
+		for _, v := range []int{int(g), int(uint16(g))} {
+			if v >= r[0] && v <= r[1] {
+				return r, true
+			}
+		}
+	}
+	return [2]int{}, false
+}
+
+// splitOutbase returns the output path without extension of the sprites of range r,
+// "<name> <start>-<end>/<name>" next to the sff output
+func splitOutbase(outbase string, r [2]int) string {
+	name := filepath.Base(outbase)
+	return filepath.Join(filepath.Dir(outbase), fmt.Sprintf("%v %v-%v", name, r[0], r[1]), name)
+}
+
+// spriteOutbase returns the output path without extension of the image and TSV of sprite s,
+// the directory of its -split range or the one of the sff
+func (sff *Sff) spriteOutbase(s *Sprite) string {
+	if r, ok := splitRange(s.Group); ok {
+		return splitOutbase(sff.outbase, r)
+	}
+	return sff.outbase
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type compressionStat struct {
+	count        int
+	compressed   int64
+	decompressed int64
+}
+
+// compressionStats holds the on-disk and decoded size of every sprite by format when -stats is used
+var compressionStats = make(map[string]*compressionStat)
+
+// recordCompression adds sprite s, stored in size bytes, to the statistics of its format
+func recordCompression(sff *Sff, s *Sprite, size uint32) {
+	format := "PCX"
+	if sff.header.Ver0 != 1 {
+		format = formatName(-s.rle)
+	}
+	st := compressionStats[format]
+	if st == nil {
+		st = &compressionStat{}
+		compressionStats[format] = st
+	}
+	st.count++
+	st.compressed += int64(size)
+	st.decompressed += int64(s.Size[0]) * int64(s.Size[1]) * int64(max(s.coldepth/8, 1))
+}
+
+func ratio(st *compressionStat) float64 {
+	if st.compressed == 0 {
+		return 0
+	}
+	return float64(st.decompressed) / float64(st.compressed)
+}
+
+// printStats prints the compression ratio of each format and of all sprites
+func printStats() {
+	names := make([]string, 0, len(compressionStats))
+	total := &compressionStat{}
+	for name, st := range compressionStats {
+		names = append(names, name)
+		total.count += st.count
+		total.compressed += st.compressed
+		total.decompressed += st.decompressed
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st := compressionStats[name]
+		fmt.Printf("%v: avg %.1fx over %v sprites (%v bytes to %v bytes)\n", name, ratio(st), st.count, st.compressed, st.decompressed)
+	}
+	fmt.Printf("All: avg %.1fx over %v sprites (%v bytes to %v bytes)\n", ratio(total), total.count, total.compressed, total.decompressed)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+)
+
+const swatchCell = 16 // size of the square showing one palette color
+
+// savePaletteSwatch writes the palette saved as actFilename as a PNG of 16x16 color cells next to it.
+// Colors are drawn opaque, translucent and transparent entries included.
+func savePaletteSwatch(pal []uint32, actFilename string) error {
+	filename := strings.TrimSuffix(actFilename, ".act") + ".swatch.png"
+	if skipWrite(filename, 16*swatchCell*16*swatchCell) {
+		return nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 16*swatchCell, 16*swatchCell))
+	for i, c := range genPalette(pal) {
+		c := straightColor(c)
+		x, y := (i%16)*swatchCell, (i/16)*swatchCell
+		cell := image.NewUniform(color.RGBA{c.R, c.G, c.B, 0xff})
+		draw.Draw(img, image.Rect(x, y, x+swatchCell, y+swatchCell), cell, image.Point{}, draw.Src)
+	}
+	fo, err := createOutput(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	return png.Encode(fo, img)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The swatch shows the straight color of transparent and translucent entries, not a darkened one
+func TestPaletteSwatch(t *testing.T) {
+	pal := testPalette(40)
+	pal[0] = 0x00302010
+	pal[1] = 0x80302010
+	actFilename := filepath.Join(t.TempDir(), "pal.act")
+	if err := savePaletteSwatch(pal, actFilename); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Open(filepath.Join(filepath.Dir(actFilename), "pal.swatch.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	img, err := png.Decode(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range pal {
+		want := color.NRGBA{byte(c), byte(c >> 8), byte(c >> 16), 0xff}
+		if got := color.NRGBAModel.Convert(img.At(i%16*swatchCell, i/16*swatchCell)); got != want {
+			t.Errorf("color %v: got %v, want %v", i, got, want)
+		}
+	}
+}
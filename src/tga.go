@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// encodeTGA writes img as an uncompressed 32-bit Targa with top-left origin.
+// Paletted images are resolved through their palette into BGRA.
+func encodeTGA(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return fmt.Errorf("Image too large for TGA: %vx%v", b.Dx(), b.Dy())
+	}
+	bw := bufio.NewWriter(w)
+	header := [18]byte{}
+	header[2] = 2 // uncompressed true-color
+	binary.LittleEndian.PutUint16(header[12:], uint16(b.Dx()))
+	binary.LittleEndian.PutUint16(header[14:], uint16(b.Dy()))
+	header[16] = 32   // bits per pixel
+	header[17] = 0x28 // 8 alpha bits, top-left origin
+	if _, err := bw.Write(header[:]); err != nil {
+		return err
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if _, err := bw.Write([]byte{c.B, c.G, c.R, c.A}); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
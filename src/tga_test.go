@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+)
+
+// decodeTGA reads an uncompressed 32-bit top-left Targa as written by encodeTGA.
+// golang.org/x/image is not a dependency of sffcli, the format is simple enough to read here.
+func decodeTGA(data []byte) (*image.NRGBA, error) {
+	if len(data) < 18 {
+		return nil, fmt.Errorf("TGA header too short")
+	}
+	if data[2] != 2 || data[16] != 32 || data[17] != 0x28 {
+		return nil, fmt.Errorf("got image type %v, %v bpp, descriptor %#x, want 2, 32 bpp, 0x28", data[2], data[16], data[17])
+	}
+	w, h := int(binary.LittleEndian.Uint16(data[12:])), int(binary.LittleEndian.Uint16(data[14:]))
+	px := data[18+int(data[0]):]
+	if len(px) != 4*w*h {
+		return nil, fmt.Errorf("got %v bytes of pixels, want %v", len(px), 4*w*h)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(px); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = px[i+2], px[i+1], px[i], px[i+3]
+	}
+	return img, nil
+}
+
+func TestEncodeTGA(t *testing.T) {
+	pal := color.Palette{color.NRGBA{0, 0, 0, 0}, color.NRGBA{10, 20, 30, 255}, color.NRGBA{200, 100, 50, 128}}
+	src := image.NewPaletted(image.Rect(0, 0, 5, 3), pal)
+	for i := range src.Pix {
+		src.Pix[i] = byte(i % 3)
+	}
+	var buf bytes.Buffer
+	if err := encodeTGA(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeTGA(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Rect != src.Rect {
+		t.Fatalf("got bounds %v, want %v", img.Rect, src.Rect)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			if got, want := img.NRGBAAt(x, y), pal[src.ColorIndexAt(x, y)]; got != want {
+				t.Errorf("pixel %v,%v: got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// A sprite extracted with -format tga reads back with the colors of its palette
+func TestExtractTGA(t *testing.T) {
+	setOption(t, &optFormat, "tga")
+	pix := testPixels(9, 4, 256)
+	sff, _ := extractTestSff(t, buildTestSffV1(testSprite{w: 9, h: 4, pix: pix}))
+	data, err := os.ReadFile(sff.spriteFilename(sff.GetSprite(0, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeTGA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal := testPalette(0)
+	for i, c := range pix {
+		want := color.NRGBA{byte(pal[c]), byte(pal[c] >> 8), byte(pal[c] >> 16), byte(pal[c] >> 24)}
+		if got := img.NRGBAAt(i%9, i/9); got != want {
+			t.Errorf("pixel %v,%v: got %v, want %v", i%9, i/9, got, want)
+		}
+	}
+}
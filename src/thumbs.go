@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+)
+
+// thumbnail shrinks img with nearest neighbor so its longest side is at most n pixels, keeping the
+// aspect ratio. Paletted images keep their indices and palette, images already small enough are returned as is.
+func thumbnail(img image.Image, n int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= n && h <= n {
+		return img
+	}
+	tw, th := n, max(1, h*n/w)
+	if h > w {
+		tw, th = max(1, w*n/h), n
+	}
+	r := image.Rect(0, 0, tw, th)
+	if p, ok := img.(*image.Paletted); ok {
+		out := image.NewPaletted(r, p.Palette)
+		for y := 0; y < th; y++ {
+			for x := 0; x < tw; x++ {
+				out.Pix[out.PixOffset(x, y)] = p.Pix[p.PixOffset(b.Min.X+x*w/tw, b.Min.Y+y*h/th)]
+			}
+		}
+		return out
+	}
+	out := image.NewNRGBA(r)
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*w/tw, b.Min.Y+y*h/th))
+		}
+	}
+	return out
+}
+
+// writeThumbnail saves the -thumbs thumbnail of sprite s under the name of its image in a "thumbs"
+// directory next to it
+func (sff *Sff) writeThumbnail(s *Sprite, img image.Image) error {
+	filename := sff.spriteFilename(s)
+	filename = filepath.Join(filepath.Dir(filename), "thumbs", filepath.Base(filename))
+	if zipOutput == nil && !optDryRun {
+		if err := sff.makeDir(filepath.Dir(filename)); err != nil {
+			return err
+		}
+	}
+	thumb := thumbnail(img, optThumbs)
+	if skipWrite(filename, thumb.Bounds().Dx()*thumb.Bounds().Dy()) {
+		return nil
+	}
+	fo, err := createOutput(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	return encodeImage(fo, thumb)
+}
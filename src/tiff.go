@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// TIFF tag numbers and field types used by encodeTIFF
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPlanarConfig    = 284
+	tiffColorMap        = 320
+	tiffExtraSamples    = 338
+
+	tiffShort = 3
+	tiffLong  = 4
+)
+
+type tiffEntry struct {
+	tag, typ uint16
+	values   []uint32
+}
+
+// singlePages collects every saved sprite when -single is used
+var singlePages []image.Image
+
+/*
+encodeTIFF writes imgs as the pages of one uncompressed little endian TIFF.
+Paletted images keep their indices and are written as 8-bit palette pages with a
+ColorMap (TIFF palettes have no alpha), other images as 8-bit RGBA pages.
+golang.org/x/image/tiff can only write a single page, hence this encoder.
+*/
+func encodeTIFF(w io.Writer, imgs []image.Image) error {
+	le := binary.LittleEndian
+	buf := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	next := 4 // where the offset of the next IFD is patched in
+	for _, img := range imgs {
+		b := img.Bounds()
+		entries := []tiffEntry{
+			{tiffImageWidth, tiffLong, []uint32{uint32(b.Dx())}},
+			{tiffImageLength, tiffLong, []uint32{uint32(b.Dy())}},
+			{tiffCompression, tiffShort, []uint32{1}},
+		}
+		start := len(buf)
+		if p, ok := img.(*image.Paletted); ok {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				buf = append(buf, p.Pix[p.PixOffset(b.Min.X, y):p.PixOffset(b.Max.X, y)]...)
+			}
+			cmap := make([]uint32, 3*256)
+			for i, c := range p.Palette {
+				if i >= 256 {
+					break
+				}
+				c := straightColor(c)
+				cmap[i], cmap[256+i], cmap[512+i] = uint32(c.R)*0x101, uint32(c.G)*0x101, uint32(c.B)*0x101
+			}
+			entries = append(entries,
+				tiffEntry{tiffBitsPerSample, tiffShort, []uint32{8}},
+				tiffEntry{tiffPhotometric, tiffShort, []uint32{3}},
+				tiffEntry{tiffSamplesPerPixel, tiffShort, []uint32{1}},
+				tiffEntry{tiffColorMap, tiffShort, cmap})
+		} else {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+					buf = append(buf, c.R, c.G, c.B, c.A)
+				}
+			}
+			var extraSamples uint32 = 2 // unassociated alpha
+			if optPremultiply {
+				extraSamples = 1 // associated alpha
+			}
+			entries = append(entries,
+				tiffEntry{tiffBitsPerSample, tiffShort, []uint32{8, 8, 8, 8}},
+				tiffEntry{tiffPhotometric, tiffShort, []uint32{2}},
+				tiffEntry{tiffSamplesPerPixel, tiffShort, []uint32{4}},
+				tiffEntry{tiffExtraSamples, tiffShort, []uint32{extraSamples}})
+		}
+		entries = append(entries,
+			tiffEntry{tiffStripOffsets, tiffLong, []uint32{uint32(start)}},
+			tiffEntry{tiffRowsPerStrip, tiffLong, []uint32{uint32(b.Dy())}},
+			tiffEntry{tiffStripByteCounts, tiffLong, []uint32{uint32(len(buf) - start)}},
+			tiffEntry{tiffPlanarConfig, tiffShort, []uint32{1}})
+		sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+		// Values that do not fit in the 4 bytes of an entry are stored before the IFD
+		offsets := make([]uint32, len(entries))
+		for i, e := range entries {
+			if tiffSize(e) <= 4 {
+				continue
+			}
+			if len(buf)%2 != 0 {
+				buf = append(buf, 0)
+			}
+			offsets[i] = uint32(len(buf))
+			buf = appendTiffValues(buf, e)
+		}
+		if len(buf)%2 != 0 {
+			buf = append(buf, 0)
+		}
+		if int64(len(buf))+int64(12*len(entries)+6) > 0xffffffff {
+			return fmt.Errorf("Too much image data for TIFF: %v bytes", len(buf))
+		}
+		le.PutUint32(buf[next:], uint32(len(buf)))
+		buf = le.AppendUint16(buf, uint16(len(entries)))
+		for i, e := range entries {
+			buf = le.AppendUint16(buf, e.tag)
+			buf = le.AppendUint16(buf, e.typ)
+			buf = le.AppendUint32(buf, uint32(len(e.values)))
+			if tiffSize(e) <= 4 {
+				value := appendTiffValues(nil, e)
+				buf = append(buf, value...)
+				buf = append(buf, make([]byte, 4-len(value))...)
+			} else {
+				buf = le.AppendUint32(buf, offsets[i])
+			}
+		}
+		next = len(buf)
+		buf = le.AppendUint32(buf, 0)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func tiffSize(e tiffEntry) int {
+	if e.typ == tiffShort {
+		return 2 * len(e.values)
+	}
+	return 4 * len(e.values)
+}
+
+func appendTiffValues(buf []byte, e tiffEntry) []byte {
+	for _, v := range e.values {
+		if e.typ == tiffShort {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(v))
+		} else {
+			buf = binary.LittleEndian.AppendUint32(buf, v)
+		}
+	}
+	return buf
+}
+
+// writeSingleTIFF writes the sprites collected for -single as one multi-page tiff, like the sprite images
+func writeSingleTIFF(filename string) error {
+	if len(singlePages) == 0 {
+		return fmt.Errorf("No sprite for multi-page TIFF %v", filename)
+	}
+	size := 0
+	for _, img := range singlePages {
+		size += img.Bounds().Dx() * img.Bounds().Dy()
+	}
+	if skipWrite(filename, size) {
+		return nil
+	}
+	fo, err := createOutputDir(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating file %v: %v", filename, err)
+	}
+	defer fo.Close()
+	if optBackground != nil {
+		for i, img := range singlePages {
+			singlePages[i] = flatten(img, *optBackground)
+		}
+	}
+	if optPremultiply {
+		for i, img := range singlePages {
+			singlePages[i] = premultipliedPixels(premultiply(img))
+		}
+	}
+	if err := encodeTIFF(fo, singlePages); err != nil {
+		return err
+	}
+	fmt.Printf("Multi-page TIFF %v created with %v pages\n", filename, len(singlePages))
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// timingWriter receives one "group,number,decodeMicros,encodeMicros" line per saved sprite when -timings is used
+var timingWriter io.Writer
+
+// timeSince returns the time elapsed since start, or zero when -timings is not used
+func timeSince(start time.Time) time.Duration {
+	if timingWriter == nil {
+		return 0
+	}
+	return time.Since(start)
+}
+
+func writeSpriteTiming(s *Sprite, decode, encode time.Duration) {
+	fmt.Fprintf(timingWriter, "%v,%v,%v,%v\n", groupNo(s.Group), groupNo(s.Number), decode.Microseconds(), encode.Microseconds())
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+)
+
+// Set at build time: go build -ldflags "-X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "1.0"
+	commit  = "unknown"
+)
+
+var (
+	supportedSffVersions = []string{"v1", "v2"}
+	supportedFormats     = []string{"PCX", "raw", "RLE8", "RLE5", "LZ5", "PNG8", "PNG24", "PNG32"}
+)
+
+// printVersion prints the tool version and the supported sff versions and sprite formats
+func printVersion(asJSON bool) {
+	if asJSON {
+		out, _ := json.MarshalIndent(map[string]any{
+			"version":     version,
+			"commit":      commit,
+			"go":          runtime.Version(),
+			"sffVersions": supportedSffVersions,
+			"formats":     supportedFormats,
+		}, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Printf("sffcli v%v (commit %v, %v)\n", version, commit, runtime.Version())
+	fmt.Printf("SFF versions: %v\n", supportedSffVersions)
+	fmt.Printf("Sprite formats: %v\n", supportedFormats)
+}